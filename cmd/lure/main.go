@@ -2,16 +2,69 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/akimsavvin/gonet/v2/graceful"
 	"github.com/akimsavvin/test_go/internal/infra/app"
+	"github.com/akimsavvin/test_go/internal/infra/config"
 	"log"
+	"os"
 )
 
+var errUnknownCommand = errors.New("unknown command")
+
+const usage = `usage: lure [flags] <command> [arguments]
+
+flags:
+  --config PATH        the base config file, ./config/config.yaml by default
+  --env NAME           the environment, its config.<env>.yaml file overlays the base one, $ENVIRONMENT by default
+
+commands:
+  all                  run the REST API and all the kafka consumers, the default
+  serve                run the REST API
+  consume [NAME...]    run the kafka consumers with the names, all of them if no names are given
+  migrate              manage the database migrations
+  config               print the effective config
+  user                 manage the users`
+
 func main() {
 	ctx, cancel := graceful.Context(context.Background())
 	defer cancel()
 
-	if err := app.Run(ctx); err != nil {
+	var src config.Source
+	flag.StringVar(&src.Path, "config", "./config/config.yaml", "the base config file")
+	flag.StringVar(&src.Env, "env", os.Getenv("ENVIRONMENT"), "the environment")
+	flag.Usage = func() {
+		fmt.Println(usage)
+	}
+	flag.Parse()
+
+	cmd, args := "all", []string(nil)
+	if flag.NArg() > 0 {
+		cmd, args = flag.Arg(0), flag.Args()[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "all":
+		err = app.Run(ctx, src, app.WithAPI(), app.WithConsumers())
+	case "serve":
+		err = app.Run(ctx, src, app.WithAPI())
+	case "consume":
+		err = app.Run(ctx, src, app.WithConsumers(args...))
+	case "migrate":
+		err = app.Migrate(ctx, src, args)
+	case "config":
+		err = app.Config(src, args)
+	case "user":
+		err = app.User(ctx, src, args)
+	default:
+		fmt.Println(usage)
+		err = fmt.Errorf("%w: %s", errUnknownCommand, cmd)
+	}
+
+	if err != nil {
 		log.Fatalln(err)
 	}
 }
@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// apiKeyPrefix marks the API keys, so they are recognizable in configs and leaks
+const apiKeyPrefix = "lure_"
+
+const (
+	APIKeyNameMaxLen   = 255
+	APIKeyScopesMaxLen = 1024
+)
+
+var (
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKeyName   = errors.New("api key name must be non-empty and at most 255 characters long")
+	ErrInvalidAPIKeyScopes = errors.New("api key scopes must be non-empty words at most 1024 characters long in total")
+	ErrInvalidAPIKeyExpiry = errors.New("api key must expire after it is created")
+)
+
+// APIKey is a key of a machine client, only its hash is stored
+type APIKey struct {
+	id         uuid.UUID
+	createdAt  time.Time
+	name       string
+	keyHash    string
+	scopes     []string
+	expiresAt  time.Time
+	revokedAt  time.Time
+	lastUsedAt time.Time
+}
+
+func NewAPIKey(
+	id uuid.UUID,
+	createdAt time.Time,
+	name string,
+	keyHash string,
+	scopes []string,
+	expiresAt time.Time,
+	revokedAt time.Time,
+	lastUsedAt time.Time) *APIKey {
+	return &APIKey{
+		id:         id,
+		createdAt:  createdAt,
+		name:       name,
+		keyHash:    keyHash,
+		scopes:     scopes,
+		expiresAt:  expiresAt,
+		revokedAt:  revokedAt,
+		lastUsedAt: lastUsedAt,
+	}
+}
+
+// IssueAPIKey creates a new API key and returns it with the plain key shown to the client only once,
+// zero expiresAt means the key never expires
+func IssueAPIKey(name string, scopes []string, expiresAt time.Time) (*APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey := NewAPIKey(uuid.New(), time.Now(), name, HashAPIKey(key), slices.Clone(scopes), expiresAt, time.Time{}, time.Time{})
+
+	return apiKey, key, nil
+}
+
+// HashAPIKey returns the hash the API key is stored and looked up by
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (k *APIKey) ID() uuid.UUID {
+	return k.id
+}
+
+func (k *APIKey) CreatedAt() time.Time {
+	return k.createdAt
+}
+
+func (k *APIKey) Name() string {
+	return k.name
+}
+
+func (k *APIKey) KeyHash() string {
+	return k.keyHash
+}
+
+func (k *APIKey) Scopes() []string {
+	return k.scopes
+}
+
+func (k *APIKey) ExpiresAt() time.Time {
+	return k.expiresAt
+}
+
+func (k *APIKey) RevokedAt() time.Time {
+	return k.revokedAt
+}
+
+func (k *APIKey) LastUsedAt() time.Time {
+	return k.lastUsedAt
+}
+
+// IsActive reports whether the key is neither revoked nor expired at the moment
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.revokedAt.IsZero() && (k.expiresAt.IsZero() || now.Before(k.expiresAt))
+}
+
+// Revoke revokes the key, revoking a revoked key keeps the first revocation time
+func (k *APIKey) Revoke() {
+	if k.revokedAt.IsZero() {
+		k.revokedAt = time.Now()
+	}
+}
+
+// MarkUsed records the key has been used at the moment
+func (k *APIKey) MarkUsed(now time.Time) {
+	k.lastUsedAt = now
+}
+
+// Validate validates the key attributes
+func (k *APIKey) Validate() error {
+	var errs []error
+
+	if k.name == "" || utf8.RuneCountInString(k.name) > APIKeyNameMaxLen {
+		errs = append(errs, ErrInvalidAPIKeyName)
+	}
+
+	scopes := strings.Join(k.scopes, " ")
+	if len(strings.Fields(scopes)) != len(k.scopes) || len(scopes) > APIKeyScopesMaxLen {
+		errs = append(errs, ErrInvalidAPIKeyScopes)
+	}
+
+	if !k.expiresAt.IsZero() && !k.expiresAt.After(k.createdAt) {
+		errs = append(errs, ErrInvalidAPIKeyExpiry)
+	}
+
+	return errors.Join(errs...)
+}
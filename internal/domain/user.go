@@ -3,7 +3,9 @@ package domain
 import (
 	"errors"
 	"github.com/google/uuid"
+	"net/mail"
 	"time"
+	"unicode/utf8"
 )
 
 type User struct {
@@ -14,8 +16,15 @@ type User struct {
 	email     string
 }
 
+const (
+	UserNameMaxLen  = 255
+	UserEmailMaxLen = 255
+)
+
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidUserName  = errors.New("user name must be non-empty and at most 255 characters long")
+	ErrInvalidUserEmail = errors.New("user email must be a valid address at most 255 characters long")
 )
 
 func NewUser(
@@ -64,6 +73,39 @@ func (u *User) Update(name, email string) {
 	u.updatedAt = time.Now()
 }
 
+// UpdatePartial updates only the provided attributes
+func (u *User) UpdatePartial(name, email *string) {
+	if name == nil && email == nil {
+		return
+	}
+
+	if name != nil {
+		u.name = *name
+	}
+
+	if email != nil {
+		u.email = *email
+	}
+
+	u.updatedAt = time.Now()
+}
+
+// Validate checks the user is in a valid state
+func (u *User) Validate() error {
+	var errs []error
+
+	if u.name == "" || utf8.RuneCountInString(u.name) > UserNameMaxLen {
+		errs = append(errs, ErrInvalidUserName)
+	}
+
+	if addr, err := mail.ParseAddress(u.email); err != nil || addr.Address != u.email ||
+		utf8.RuneCountInString(u.email) > UserEmailMaxLen {
+		errs = append(errs, ErrInvalidUserEmail)
+	}
+
+	return errors.Join(errs...)
+}
+
 type UserCreatedEvent struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -4,128 +4,369 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/XSAM/otelsql"
 	"github.com/akimsavvin/gonet/v2/di"
-	"github.com/akimsavvin/test_go/internal/domain"
 	"github.com/akimsavvin/test_go/internal/infra/config"
-	"github.com/akimsavvin/test_go/internal/infra/eventbus"
+	"github.com/akimsavvin/test_go/internal/infra/metrics"
 	"github.com/akimsavvin/test_go/internal/infra/storage"
 	"github.com/akimsavvin/test_go/internal/presentation/kfk"
 	"github.com/akimsavvin/test_go/internal/presentation/rest"
-	"github.com/akimsavvin/test_go/internal/usecase"
-	"github.com/akimsavvin/test_go/pkg/cache"
+	"github.com/akimsavvin/test_go/pkg/health"
+	"github.com/akimsavvin/test_go/pkg/jwtauth"
+	"github.com/akimsavvin/test_go/pkg/ratelimit"
 	"github.com/akimsavvin/test_go/pkg/sl"
 	"github.com/gofiber/fiber/v3"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/redis/go-redis/v9"
-	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"golang.org/x/sync/errgroup"
 	"log/slog"
-	"net/http"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 )
 
-func Run(ctx context.Context) error {
-	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelDebug,
-	}))
+func newTokenVerifier(cfg config.Auth) (*jwtauth.Verifier, error) {
+	var opts []jwtauth.Option
+	if cfg.HMACSecret != "" {
+		opts = append(opts, jwtauth.WithHMACKey("", []byte(cfg.HMACSecret)))
+	}
+	if cfg.PublicKeyFile != "" {
+		opts = append(opts, jwtauth.WithPEMKeyFile("", cfg.PublicKeyFile))
+	}
+	if cfg.JWKSFile != "" {
+		opts = append(opts, jwtauth.WithJWKSFile(cfg.JWKSFile))
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwtauth.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwtauth.WithAudience(cfg.Audience))
+	}
 
-	var cfg config.Config
-	if err := cleanenv.ReadConfig("./config/config.yaml", &cfg); err != nil {
-		return err
+	return jwtauth.New(opts...)
+}
+
+var ErrUnknownRateLimitKey = errors.New("rate limit key must be one of ip, api_key and principal")
+
+func routeRateLimit(cfg config.RouteRateLimit) (rest.RouteRateLimit, error) {
+	limit := rest.RouteRateLimit{
+		Limit: ratelimit.Limit{
+			Requests: cfg.Requests,
+			Period:   cfg.Period,
+			Burst:    cfg.Burst,
+		},
+		Key: rest.RateLimitKey(cfg.Key),
+	}
+	if limit.Burst == 0 {
+		limit.Burst = limit.Requests
 	}
 
-	c := di.NewContainer(
-		di.WithValue(log),
-		di.WithKeyedFactory("master", func() (*sql.DB, error) {
-			return sql.Open("pgx", cfg.DB.MasterURL)
-		}),
-		di.WithKeyedFactory("slave", func() (*sql.DB, error) {
-			return sql.Open("pgx", cfg.DB.SlaveURL)
-		}),
-		di.WithFactory(func(c *di.Container) (*sql.DB, error) {
-			return di.GetKeyedService[*sql.DB](c, "master")
-		}),
-		di.WithFactory(func(log *slog.Logger, c *di.Container) (usecase.UnitOfWorkFactory, error) {
-			master := di.MustGetKeyedService[*sql.DB](c, "master")
-			slave := di.MustGetKeyedService[*sql.DB](c, "slave")
-			return storage.NewUnitOfWorkFactory(log, master, slave), nil
-		}),
-		di.WithValue(redis.NewClient(&redis.Options{
-			Addr: "localhost:6379",
-		})),
-		di.WithService[cache.JsonCache](cache.NewRedisJsonCache),
-		di.WithFactory(func(log *slog.Logger) eventbus.Publisher[*domain.UserCreatedEvent] {
-			return eventbus.NewUserCreatedEventPublisher(log, &kafka.Writer{
-				Addr:  kafka.TCP(cfg.UserCreatedPub.Brokers...),
-				Topic: cfg.UserCreatedPub.Topic,
-			})
-		}),
-		di.WithFactory(func(
-			log *slog.Logger,
-			userCreatedPub eventbus.Publisher[*domain.UserCreatedEvent],
-		) usecase.EventBus {
-			return eventbus.New(log,
-				eventbus.WithEventPublisher(userCreatedPub),
-			)
-		}),
-		di.WithFactory(usecase.NewUserUseCase),
-		di.WithService[rest.Controller](rest.NewUserController),
-		di.WithService[kfk.Consumer](func(log *slog.Logger, useCase usecase.UserUseCase) *kfk.CreateUserConsumer {
-			consCfg := kfk.ConsumerConfig{
-				Brokers: cfg.CreateUserCons.Brokers,
-				Topic:   cfg.CreateUserCons.Topic,
-				GroupID: cfg.CreateUserCons.Topic,
-			}
+	switch limit.Key {
+	case "":
+		limit.Key = rest.RateLimitByPrincipal
+	case rest.RateLimitByIP, rest.RateLimitByAPIKey, rest.RateLimitByPrincipal:
+	default:
+		return rest.RouteRateLimit{}, ErrUnknownRateLimitKey
+	}
+
+	return limit, nil
+}
+
+// rateLimits converts the configured limits of the routes and the default one
+func rateLimits(cfg config.RateLimit) (map[string]rest.RouteRateLimit, *rest.RouteRateLimit, error) {
+	routes := make(map[string]rest.RouteRateLimit, len(cfg.Routes))
+	for route, routeCfg := range cfg.Routes {
+		limit, err := routeRateLimit(routeCfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("route %s: %w", route, err)
+		}
+		routes[route] = limit
+	}
+
+	var def *rest.RouteRateLimit
+	if cfg.Default != nil {
+		limit, err := routeRateLimit(*cfg.Default)
+		if err != nil {
+			return nil, nil, fmt.Errorf("default: %w", err)
+		}
+		def = &limit
+	}
 
-			return kfk.NewCreateUserConsumer(log, consCfg, useCase)
+	return routes, def, nil
+}
+
+// newRateLimiter limits the routes through Redis falling back to the in-memory limits,
+// it returns nil when the rate limiting is disabled
+func newRateLimiter(log *slog.Logger, cfg config.RateLimit, client redis.Scripter) (*rest.RateLimiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	routes, def, err := rateLimits(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := ratelimit.NewFallbackLimiter(log,
+		ratelimit.NewRedisLimiter(client, cfg.RedisPrefix),
+		ratelimit.NewMemoryLimiter(),
+	)
+
+	return rest.NewRateLimiter(log, limiter, routes, def)
+}
+
+// newHealthRegistries creates the liveness registry checking the consumers
+// and the readiness one checking the storages and brokers as well
+func newHealthRegistries(
+	cfg config.Health,
+	master, slave *sql.DB,
+	client redis.UniversalClient,
+	kafkaChecks map[string]health.Checker,
+	consumers []kfk.Consumer) (liveness, readiness *health.Registry) {
+	opts := []health.Option{
+		health.WithTimeout(cfg.Timeout),
+		health.WithCacheTTL(cfg.CacheTTL),
+	}
+	liveness = health.NewRegistry(opts...)
+	readiness = health.NewRegistry(opts...)
+
+	readiness.Register("postgres_master", health.DB(master))
+	readiness.Register("postgres_slave", health.DB(slave))
+	readiness.Register("redis", health.Redis(client))
+	for _, name := range slices.Sorted(maps.Keys(kafkaChecks)) {
+		readiness.Register(name, kafkaChecks[name])
+	}
+
+	for _, cons := range consumers {
+		name := "kafka_consumer:" + cons.Name()
+		liveness.Register(name, cons)
+		readiness.Register(name, cons)
+	}
+
+	return liveness, readiness
+}
+
+// openDB opens the database tracing its statements and exposing its connection pool stats labeled with name
+func openDB(m *metrics.Metrics, name, url string) (*sql.DB, error) {
+	db, err := otelsql.Open("pgx", url,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, attribute.String("db.instance", name)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
 		}),
 	)
+	if err != nil {
+		return nil, err
+	}
 
-	log = log.With(sl.Op("app.Run"))
+	if err = m.RegisterDB(name, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+var ErrUnknownConsumer = errors.New("unknown kafka consumer")
+
+type runOptions struct {
+	api       bool
+	consume   bool
+	consumers []string
+}
 
-	db := di.MustGetService[*sql.DB](c)
-	log.Debug("migrating database")
-	if err := storage.Migrate(db); err != nil {
-		log.Debug("could not migrate database", sl.Err(err))
+type RunOption func(*runOptions)
+
+// WithAPI serves the REST API besides the health and metrics endpoints
+func WithAPI() RunOption {
+	return func(opts *runOptions) {
+		opts.api = true
+	}
+}
+
+// WithConsumers runs the kafka consumers with the names, all of them if no names are given
+func WithConsumers(names ...string) RunOption {
+	return func(opts *runOptions) {
+		opts.consume = true
+		opts.consumers = names
+	}
+}
+
+// selectConsumers returns the consumers with the names, all of them if no names are given
+func selectConsumers(consumers []kfk.Consumer, names []string) ([]kfk.Consumer, error) {
+	if len(names) == 0 {
+		return consumers, nil
+	}
+
+	available := make([]string, 0, len(consumers))
+	for _, cons := range consumers {
+		available = append(available, cons.Name())
+	}
+
+	selected := make([]kfk.Consumer, 0, len(names))
+	for _, name := range names {
+		i := slices.Index(available, name)
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s, available: %s", ErrUnknownConsumer, name, strings.Join(available, ", "))
+		}
+		selected = append(selected, consumers[i])
+	}
+
+	return selected, nil
+}
+
+// Run serves the health and metrics endpoints with the REST API and the kafka consumers enabled by the options
+// until the context is cancelled, then it shuts down gracefully
+func Run(ctx context.Context, src config.Source, opts ...RunOption) (err error) {
+	var runOpts runOptions
+	for _, opt := range opts {
+		opt(&runOpts)
+	}
+
+	s, err := newServices(ctx, src, os.Stdout)
+	if err != nil {
 		return err
 	}
-	log.Info("migrated database")
+	// the services are closed by the shutdown once it is started, here only when the startup fails
+	var shuttingDown bool
+	defer func() {
+		if !shuttingDown {
+			err = errors.Join(err, s.close())
+		}
+	}()
+	cfg, c, m := s.cfg, s.c, s.m
 
-	g, ctx := errgroup.WithContext(ctx)
+	log := s.log.With(sl.Op("app.Run"))
 
-	g.Go(func() error {
-		log := log.With(slog.String("address", cfg.RestServer.Addr))
-		log.Debug("starting REST server")
+	if cfg.DB.AutoMigrate {
+		if err = storage.Migrate(ctx, log, cfg.DB.MasterURL); err != nil {
+			return err
+		}
+	}
+
+	var consumers []kfk.Consumer
+	if runOpts.consume {
+		consumers, err = selectConsumers(di.MustGetService[[]kfk.Consumer](c), runOpts.consumers)
+		if err != nil {
+			return err
+		}
+	}
+
+	liveness, readiness := newHealthRegistries(
+		cfg.Health,
+		di.MustGetKeyedService[*sql.DB](c, "master"),
+		di.MustGetKeyedService[*sql.DB](c, "slave"),
+		s.redisClient,
+		map[string]health.Checker{
+			"kafka:create_user_consumer":   health.Kafka(s.createUserDialer, cfg.CreateUserCons.Brokers),
+			"kafka:user_created_publisher": health.Kafka(s.userCreatedDialer, cfg.UserCreatedPub.Brokers),
+		},
+		consumers,
+	)
+
+	// the bodies are streamed for the imports, the other handlers read them up to the body limit
+	fiberApp := fiber.New(fiber.Config{
+		BodyLimit:         cfg.RestServer.BodyLimit,
+		StreamRequestBody: true,
+		ErrorHandler:      rest.ErrorHandler,
+	})
+	fiberApp.Use(rest.RequestID(), rest.Trace(), rest.Instrument(m))
+	fiberApp.Get("/metrics", adaptor.HTTPHandler(m.Handler()))
+	rest.InitHealth(fiberApp, liveness, readiness)
 
-		fiberApp := fiber.New()
-		v1 := fiberApp.Group("/api/v1")
+	if runOpts.api {
+		api := fiberApp.Group("/api")
+		// the IP limits run before the authentication, so the invalid credentials are limited too
+		v1 := api.Group("/v1",
+			di.MustGetService[*rest.RateLimiter](c).LimitByIP("/api/v1"),
+			rest.Authenticate(
+				di.MustGetService[rest.TokenVerifier](c),
+				di.MustGetService[rest.APIKeyAuthenticator](c),
+			),
+		)
 
-		for _, cont := range di.MustGetService[[]rest.Controller](c) {
+		conts := di.MustGetService[[]rest.Controller](c)
+		for _, cont := range conts {
 			cont.Init(v1)
 		}
 
-		if err := fiberApp.Listen(cfg.RestServer.Addr); err != nil {
-			if errors.Is(err, http.ErrServerClosed) {
-				log.Info("REST server stopped")
-			} else {
-				log.Error("could not start REST server", err.Error())
-			}
+		doc := rest.BuildOpenAPI(rest.OpenAPIInfo{
+			Title:   "Lure API",
+			Version: "v1",
+		}, "/api/v1", conts)
+		// the drift is caught by the tests, the served document is still useful with it
+		if err := rest.VerifyOpenAPI(doc, "/api/v1", fiberApp.GetRoutes(true)); err != nil {
+			log.Warn("OpenAPI document does not match the routes", sl.Err(err))
+		}
+		rest.InitDocs(api, "/api", doc)
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
 
+	g.Go(func() error {
+		log := log.With(slog.String("address", cfg.RestServer.Addr), slog.Bool("api", runOpts.api))
+		log.Debug("starting REST server")
+
+		if err := fiberApp.Listen(cfg.RestServer.Addr); err != nil {
+			log.Error("could not start REST server", sl.Err(err))
 			return err
 		}
 
+		log.Info("REST server stopped")
 		return nil
 	})
 
-	log.Debug("starting kafka consumers")
-	for _, cons := range di.MustGetService[[]kfk.Consumer](c) {
+	watcher := newConfigWatcher(s, src)
+	g.Go(func() error {
+		return watcher.Run(gCtx, cfg.Reload.Interval)
+	})
+
+	log.Debug("starting kafka consumers", slog.Int("count", len(consumers)))
+	for _, cons := range consumers {
 		g.Go(func() error {
-			return cons.Run(ctx)
+			// the consumer drains its in-flight message after the context is cancelled
+			if err := cons.Run(gCtx); !errors.Is(err, kfk.ErrConsumerStopped) {
+				return err
+			}
+
+			return nil
 		})
 	}
 
-	return g.Wait()
+	groupErr := make(chan error, 1)
+	go func() {
+		groupErr <- g.Wait()
+	}()
+
+	// the context is cancelled either by a signal or by a failed server or consumer
+	<-gCtx.Done()
+	log.Info("shutting down", slog.Duration("timeout", cfg.Shutdown.Timeout))
+	shuttingDown = true
+
+	var runErr error
+	phases := []shutdownPhase{
+		{
+			name: "stop REST server",
+			run:  fiberApp.ShutdownWithContext,
+		},
+		{
+			name: "drain consumers",
+			run: func(ctx context.Context) error {
+				select {
+				case runErr = <-groupErr:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			},
+		},
+	}
+	err = shutdown(log, cfg.Shutdown.Timeout, append(phases, s.closePhases()...)...)
+
+	return errors.Join(runErr, err)
 }
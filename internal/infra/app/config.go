@@ -0,0 +1,45 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+var (
+	ErrUnknownConfigCommand = errors.New("unknown config command")
+)
+
+const configUsage = `usage: lure config <command>
+
+commands:
+  print        print the effective config with the secrets masked`
+
+// Config runs the config subcommand with the given arguments
+func Config(src config.Source, args []string) error {
+	if len(args) == 0 {
+		fmt.Println(configUsage)
+		return ErrUnknownConfigCommand
+	}
+
+	switch cmd := args[0]; cmd {
+	case "print":
+		cfg, err := config.Load(src)
+		if err != nil {
+			return err
+		}
+
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err = enc.Encode(cfg.Masked()); err != nil {
+			return err
+		}
+
+		return enc.Close()
+	default:
+		fmt.Println(configUsage)
+		return fmt.Errorf("%w: %s", ErrUnknownConfigCommand, cmd)
+	}
+}
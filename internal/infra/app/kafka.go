@@ -0,0 +1,125 @@
+package app
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"github.com/akimsavvin/test_go/internal/presentation/kfk"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// kafkaSecurity creates the TLS config and the SASL mechanism of the client, they are nil when disabled
+func kafkaSecurity(cfg config.KafkaClient) (*tls.Config, sasl.Mechanism, error) {
+	tlsCfg, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kafka TLS: %w", err)
+	}
+
+	var mechanism sasl.Mechanism
+	switch cfg.SASL.Mechanism {
+	case "plain":
+		mechanism = plain.Mechanism{
+			Username: cfg.SASL.Username,
+			Password: cfg.SASL.Password,
+		}
+	case "scram-sha-256":
+		mechanism, err = scram.Mechanism(scram.SHA256, cfg.SASL.Username, cfg.SASL.Password)
+	case "scram-sha-512":
+		mechanism, err = scram.Mechanism(scram.SHA512, cfg.SASL.Username, cfg.SASL.Password)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("kafka SASL: %w", err)
+	}
+
+	return tlsCfg, mechanism, nil
+}
+
+// newKafkaDialer creates the dialer of the readers and the health checks
+func newKafkaDialer(cfg config.KafkaClient) (*kafka.Dialer, error) {
+	tlsCfg, mechanism, err := kafkaSecurity(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		ClientID:      cfg.ID,
+		Timeout:       cfg.DialTimeout,
+		DualStack:     true,
+		TLS:           tlsCfg,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// newKafkaWriter creates the writer of the publisher
+func newKafkaWriter(cfg config.UserCreatedPublisher) (*kafka.Writer, error) {
+	tlsCfg, mechanism, err := kafkaSecurity(cfg.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		BatchSize:    cfg.BatchSize,
+		BatchBytes:   cfg.BatchBytes,
+		BatchTimeout: cfg.BatchTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		Transport: &kafka.Transport{
+			ClientID:    cfg.Client.ID,
+			DialTimeout: cfg.Client.DialTimeout,
+			TLS:         tlsCfg,
+			SASL:        mechanism,
+		},
+	}
+
+	switch cfg.RequiredAcks {
+	case "none":
+		w.RequiredAcks = kafka.RequireNone
+	case "one":
+		w.RequiredAcks = kafka.RequireOne
+	case "all":
+		w.RequiredAcks = kafka.RequireAll
+	}
+
+	switch cfg.Compression {
+	case "gzip":
+		w.Compression = kafka.Gzip
+	case "snappy":
+		w.Compression = kafka.Snappy
+	case "lz4":
+		w.Compression = kafka.Lz4
+	case "zstd":
+		w.Compression = kafka.Zstd
+	}
+
+	return w, nil
+}
+
+// newConsumerConfig converts the consumer config reading through the dialer,
+// the group falls back to the required topic when it is not configured
+func newConsumerConfig(cfg config.CreateUserConsumer, dialer *kafka.Dialer) kfk.ConsumerConfig {
+	groupID := cfg.GroupID
+	if groupID == "" {
+		groupID = cfg.Topic
+	}
+
+	consCfg := kfk.ConsumerConfig{
+		Brokers:        cfg.Brokers,
+		Topic:          cfg.Topic,
+		GroupID:        groupID,
+		Dialer:         dialer,
+		MinBytes:       cfg.MinBytes,
+		MaxBytes:       cfg.MaxBytes,
+		MaxWait:        cfg.MaxWait,
+		CommitInterval: cfg.CommitInterval,
+		StartOffset:    kafka.FirstOffset,
+	}
+	if cfg.StartOffset == "last" {
+		consCfg.StartOffset = kafka.LastOffset
+	}
+
+	return consCfg
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"io"
+	"log/slog"
+)
+
+var (
+	ErrUnknownLogFormat  = errors.New("log format must be json or text")
+	ErrUnknownRedactMode = errors.New("log redact mode must be mask or hash")
+)
+
+// logLevels parses the default level and the module levels
+func logLevels(cfg config.Logging) (slog.Level, map[string]slog.Level, error) {
+	var def slog.Level
+	if err := def.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return 0, nil, fmt.Errorf("log level: %w", err)
+	}
+
+	modules := make(map[string]slog.Level, len(cfg.Modules))
+	for module, text := range cfg.Modules {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(text)); err != nil {
+			return 0, nil, fmt.Errorf("log level of %s: %w", module, err)
+		}
+		modules[module] = level
+	}
+
+	return def, modules, nil
+}
+
+// newLogger creates the logger writing to w and the levels changing its default and module levels at runtime
+func newLogger(cfg config.Logging, w io.Writer) (*slog.Logger, *sl.Levels, error) {
+	def, modules, err := logLevels(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the levels are filtered by sl.LevelHandler, so the underlying handler enables all of them
+	opts := &slog.HandlerOptions{
+		AddSource: cfg.AddSource,
+		Level:     slog.Level(-8),
+	}
+
+	var h slog.Handler
+	switch cfg.Format {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, nil, ErrUnknownLogFormat
+	}
+
+	redactOpts := []sl.RedactOption{sl.WithRedactKeys(cfg.Redact.Keys...)}
+	switch cfg.Redact.Mode {
+	case "mask":
+	case "hash":
+		redactOpts = append(redactOpts,
+			sl.WithRedactMode(sl.RedactHash),
+			sl.WithHashKey([]byte(cfg.Redact.HashKey)),
+		)
+	default:
+		return nil, nil, ErrUnknownRedactMode
+	}
+	h = sl.NewRedactHandler(h, redactOpts...)
+
+	if cfg.Sampling.Enabled {
+		h = sl.NewSamplingHandler(h, cfg.Sampling.First, cfg.Sampling.Thereafter, cfg.Sampling.Tick, slog.LevelWarn)
+	}
+
+	levels := sl.NewLevels(def, modules)
+	h = sl.NewContextHandler(sl.NewLevelHandler(h, levels))
+
+	return slog.New(h), levels, nil
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"github.com/akimsavvin/test_go/internal/infra/storage"
+	"strconv"
+)
+
+var (
+	ErrUnknownMigrateCommand = errors.New("unknown migrate command")
+)
+
+const migrateUsage = `usage: lure migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down N       roll back N migrations
+  goto V       migrate up or down to version V
+  force V      set version V without migrating and clear the dirty flag
+  version      print the current version
+  status       print the status of every migration`
+
+// Migrate runs the migrate subcommand with the given arguments
+func Migrate(ctx context.Context, src config.Source, args []string) error {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		return ErrUnknownMigrateCommand
+	}
+
+	cfg, err := config.Load(src)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("pgx", cfg.DB.MasterURL)
+	if err != nil {
+		return err
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	mig, err := storage.NewMigrator(db)
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+	defer mig.Close()
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "up":
+		return mig.Up()
+	case "down":
+		n, err := intArg(args)
+		if err != nil {
+			return err
+		}
+
+		return mig.Down(n)
+	case "goto":
+		v, err := intArg(args)
+		if err != nil {
+			return err
+		}
+
+		return mig.Goto(uint(v))
+	case "force":
+		v, err := intArg(args)
+		if err != nil {
+			return err
+		}
+
+		return mig.Force(v)
+	case "version":
+		v, dirty, err := mig.Version()
+		if err != nil {
+			return err
+		}
+
+		if dirty {
+			fmt.Printf("%d (dirty)\n", v)
+		} else {
+			fmt.Println(v)
+		}
+
+		return nil
+	case "status":
+		statuses, err := mig.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, st := range statuses {
+			state := "pending"
+			if st.Current {
+				state = "current"
+			} else if st.Applied {
+				state = "applied"
+			}
+
+			fmt.Printf("%d\t%s\n", st.Version, state)
+		}
+
+		return nil
+	default:
+		fmt.Println(migrateUsage)
+		return fmt.Errorf("%w: %s", ErrUnknownMigrateCommand, cmd)
+	}
+}
+
+func intArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected a single numeric argument")
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid numeric argument: %s", args[0])
+	}
+
+	return n, nil
+}
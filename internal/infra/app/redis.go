@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrRedisStandaloneAddrs = errors.New("redis standalone mode needs a single address")
+
+// newRedisClient creates the standalone, sentinel or cluster client of the configured mode
+func newRedisClient(cfg config.Redis) (redis.UniversalClient, error) {
+	if cfg.Mode == "standalone" && len(cfg.Addrs) != 1 {
+		return nil, ErrRedisStandaloneAddrs
+	}
+
+	tlsCfg, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("redis TLS: %w", err)
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		MaxIdleConns:     cfg.MaxIdleConns,
+		DialTimeout:      cfg.DialTimeout,
+		ReadTimeout:      cfg.ReadTimeout,
+		WriteTimeout:     cfg.WriteTimeout,
+		PoolTimeout:      cfg.PoolTimeout,
+		TLSConfig:        tlsCfg,
+	}
+
+	// the mode is explicit, so a single seed node is not mistaken for a standalone server
+	switch cfg.Mode {
+	case "sentinel":
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case "cluster":
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"github.com/akimsavvin/gonet/v2/di"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"github.com/akimsavvin/test_go/internal/presentation/rest"
+	"github.com/akimsavvin/test_go/pkg/cache"
+)
+
+// newConfigWatcher creates the config watcher applying live the log levels, the rate limits,
+// the cache expiration and the feature toggles, the other changes need a restart
+func newConfigWatcher(s *services, src config.Source) *config.Watcher {
+	w := config.NewWatcher(s.log, src, s.cfg)
+
+	w.Subscribe(func(ch *config.Change) error {
+		def, modules, err := logLevels(ch.New.Logging)
+		if err != nil {
+			return err
+		}
+
+		if ch.Has("logging.level") {
+			s.levels.SetDefault(def)
+		}
+
+		if ch.Has("logging.modules") {
+			// the overrides set at runtime for the modules missing in the config are kept
+			for module := range ch.Old.Logging.Modules {
+				if _, ok := modules[module]; !ok {
+					s.levels.ResetModule(module)
+				}
+			}
+			for module, level := range modules {
+				s.levels.SetModule(module, level)
+			}
+		}
+
+		return nil
+	}, "logging.level", "logging.modules")
+
+	// the limiter is not created when the rate limiting is disabled, so the limits changes need a restart then
+	if rl := di.MustGetService[*rest.RateLimiter](s.c); rl != nil {
+		w.Subscribe(func(ch *config.Change) error {
+			routes, def, err := rateLimits(ch.New.RateLimit)
+			if err != nil {
+				return err
+			}
+
+			return rl.SetLimits(routes, def)
+		}, "rate_limit.default", "rate_limit.routes")
+	}
+
+	w.Subscribe(func(ch *config.Change) error {
+		di.MustGetService[*cache.ExpiringJsonCache](s.c).SetExpiration(ch.New.Cache.Expiration)
+		return nil
+	}, "cache.expiration")
+
+	w.Subscribe(func(ch *config.Change) error {
+		s.flags.Set(ch.New.Features)
+		return nil
+	}, "features")
+
+	return w
+}
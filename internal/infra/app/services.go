@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"github.com/akimsavvin/gonet/v2/di"
+	"github.com/akimsavvin/test_go/internal/domain"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"github.com/akimsavvin/test_go/internal/infra/eventbus"
+	"github.com/akimsavvin/test_go/internal/infra/metrics"
+	"github.com/akimsavvin/test_go/internal/infra/storage"
+	"github.com/akimsavvin/test_go/internal/infra/tracing"
+	"github.com/akimsavvin/test_go/internal/presentation/kfk"
+	"github.com/akimsavvin/test_go/internal/presentation/rest"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/cache"
+	"github.com/akimsavvin/test_go/pkg/feature"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"log/slog"
+)
+
+// services is the wiring shared by the commands, the services of the container are created on the first use
+type services struct {
+	cfg    *config.Config
+	log    *slog.Logger
+	levels *sl.Levels
+	flags  *feature.Flags
+	m      *metrics.Metrics
+	c      *di.Container
+
+	redisClient       redis.UniversalClient
+	createUserDialer  *kafka.Dialer
+	userCreatedDialer *kafka.Dialer
+	userCreatedWriter *kafka.Writer
+	tasks             *usecase.BackgroundTasks
+	shutdownTracing   tracing.ShutdownFunc
+}
+
+// newServices loads the config from src and wires the services logging to logOut
+func newServices(ctx context.Context, src config.Source, logOut io.Writer) (*services, error) {
+	cfg, err := config.Load(src)
+	if err != nil {
+		return nil, err
+	}
+
+	log, levels, err := newLogger(cfg.Logging, logOut)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := metrics.New()
+	if err != nil {
+		return nil, err
+	}
+
+	redisClient, err := newRedisClient(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	createUserDialer, err := newKafkaDialer(cfg.CreateUserCons.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	userCreatedDialer, err := newKafkaDialer(cfg.UserCreatedPub.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	userCreatedWriter, err := newKafkaWriter(cfg.UserCreatedPub)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := feature.NewFlags(cfg.Features)
+	tasks := usecase.NewBackgroundTasks()
+
+	c := di.NewContainer(
+		di.WithValue(log),
+		di.WithValue(m),
+		di.WithValue(flags),
+		di.WithValue(tasks),
+		di.WithKeyedFactory("master", func() (*sql.DB, error) {
+			return openDB(m, "master", cfg.DB.MasterURL)
+		}),
+		di.WithKeyedFactory("slave", func() (*sql.DB, error) {
+			return openDB(m, "slave", cfg.DB.SlaveURL)
+		}),
+		di.WithFactory(func(c *di.Container) (*sql.DB, error) {
+			return di.GetKeyedService[*sql.DB](c, "master")
+		}),
+		di.WithFactory(func(log *slog.Logger, c *di.Container) (usecase.UnitOfWorkFactory, error) {
+			master := di.MustGetKeyedService[*sql.DB](c, "master")
+			slave := di.MustGetKeyedService[*sql.DB](c, "slave")
+			return storage.NewUnitOfWorkFactory(log, master, slave, storage.WithWorkObserver(m)), nil
+		}),
+		di.WithFactory(func() redis.UniversalClient {
+			return redisClient
+		}),
+		di.WithFactory(func(client redis.UniversalClient) (*cache.ExpiringJsonCache, error) {
+			jc, err := cache.NewRedisJsonCache(client)
+			if err != nil {
+				return nil, err
+			}
+
+			return cache.NewExpiringJsonCache(jc, cfg.Cache.Expiration), nil
+		}),
+		di.WithFactory(func(ec *cache.ExpiringJsonCache) cache.JsonCache {
+			return cache.NewObservedJsonCache(cache.NewTracedJsonCache(ec), m)
+		}),
+		di.WithFactory(func(log *slog.Logger, client redis.UniversalClient) (*rest.RateLimiter, error) {
+			return newRateLimiter(log, cfg.RateLimit, client)
+		}),
+		di.WithFactory(func(log *slog.Logger) eventbus.Publisher[*domain.UserCreatedEvent] {
+			return eventbus.NewUserCreatedEventPublisher(log, userCreatedWriter)
+		}),
+		di.WithFactory(func(
+			log *slog.Logger,
+			userCreatedPub eventbus.Publisher[*domain.UserCreatedEvent],
+		) usecase.EventBus {
+			return eventbus.New(log,
+				eventbus.WithEventPublisher(userCreatedPub),
+				eventbus.WithObserver(m),
+			)
+		}),
+		di.WithFactory(func() (rest.TokenVerifier, error) {
+			return newTokenVerifier(cfg.Auth)
+		}),
+		di.WithFactory(usecase.NewUserUseCase),
+		di.WithFactory(func(log *slog.Logger, c *di.Container) usecase.APIKeyUsageRepo {
+			return storage.NewAPIKeyRepo(log, di.MustGetKeyedService[*sql.DB](c, "master"), nil)
+		}),
+		di.WithFactory(usecase.NewAPIKeyUseCase),
+		di.WithFactory(func(useCase usecase.APIKeyUseCase) rest.APIKeyAuthenticator {
+			return useCase
+		}),
+		di.WithService[rest.Controller](rest.NewAPIKeyController),
+		di.WithService[rest.Controller](func() *rest.LogLevelController {
+			return rest.NewLogLevelController(levels)
+		}),
+		di.WithService[rest.Controller](func(
+			log *slog.Logger,
+			rl *rest.RateLimiter,
+			useCase usecase.UserUseCase,
+		) *rest.UserController {
+			contCfg := rest.UserControllerConfig{
+				MaxBatchSize:    cfg.RestServer.MaxBatchSize,
+				ImportBatchSize: cfg.RestServer.ImportBatchSize,
+				RateLimiter:     rl,
+			}
+
+			return rest.NewUserController(log, contCfg, useCase)
+		}),
+		di.WithService[kfk.Consumer](func(log *slog.Logger, useCase usecase.UserUseCase) *kfk.CreateUserConsumer {
+			return kfk.NewCreateUserConsumer(log, newConsumerConfig(cfg.CreateUserCons, createUserDialer), useCase, m)
+		}),
+	)
+
+	return &services{
+		cfg:               cfg,
+		log:               log,
+		levels:            levels,
+		flags:             flags,
+		m:                 m,
+		c:                 c,
+		redisClient:       redisClient,
+		createUserDialer:  createUserDialer,
+		userCreatedDialer: userCreatedDialer,
+		userCreatedWriter: userCreatedWriter,
+		tasks:             tasks,
+		shutdownTracing:   shutdownTracing,
+	}, nil
+}
+
+// closePhases drains the background tasks, flushes the publishers, closes the storages and flushes the traces
+func (s *services) closePhases() []shutdownPhase {
+	master := di.MustGetKeyedService[*sql.DB](s.c, "master")
+	slave := di.MustGetKeyedService[*sql.DB](s.c, "slave")
+
+	return []shutdownPhase{
+		{
+			name: "drain background tasks",
+			run:  s.tasks.Wait,
+		},
+		closePhase("flush publishers", s.userCreatedWriter.Close),
+		closePhase("close storages", master.Close, slave.Close, s.redisClient.Close),
+		{
+			name: "flush traces",
+			run:  s.shutdownTracing,
+		},
+	}
+}
+
+// close runs the close phases within the shutdown timeout
+func (s *services) close() error {
+	return shutdown(s.log, s.cfg.Shutdown.Timeout, s.closePhases()...)
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"log/slog"
+	"time"
+)
+
+// shutdownPhase is a named step of the shutdown sequence
+type shutdownPhase struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// shutdown runs the phases in order sharing the timeout,
+// a failed phase is logged and does not prevent the next ones from running
+func shutdown(log *slog.Logger, timeout time.Duration, phases ...shutdownPhase) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	for _, phase := range phases {
+		log := log.With(slog.String("phase", phase.name))
+		log.Info("shutdown phase started")
+
+		start := time.Now()
+		if err := phase.run(ctx); err != nil {
+			log.Error("shutdown phase failed", sl.Err(err), slog.Duration("duration", time.Since(start)))
+			errs = append(errs, fmt.Errorf("%s: %w", phase.name, err))
+			continue
+		}
+
+		log.Info("shutdown phase completed", slog.Duration("duration", time.Since(start)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// closePhase adapts the close function to a phase ignoring the deadline
+func closePhase(name string, closers ...func() error) shutdownPhase {
+	return shutdownPhase{
+		name: name,
+		run: func(context.Context) error {
+			errs := make([]error, 0, len(closers))
+			for _, c := range closers {
+				errs = append(errs, c())
+			}
+
+			return errors.Join(errs...)
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/gonet/v2/di"
+	"github.com/akimsavvin/test_go/internal/infra/config"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/google/uuid"
+	"os"
+)
+
+var (
+	ErrUnknownUserCommand = errors.New("unknown user command")
+)
+
+const userUsage = `usage: lure user <command>
+
+commands:
+  get ID               print the user as JSON
+  create NAME EMAIL    create a user and print its identifier
+  delete ID            delete the user
+  reindex              refresh the cached users from the database`
+
+// User runs the user subcommand with the given arguments, the logs are written to stderr
+func User(ctx context.Context, src config.Source, args []string) (err error) {
+	if len(args) == 0 {
+		fmt.Println(userUsage)
+		return ErrUnknownUserCommand
+	}
+
+	s, err := newServices(ctx, src, os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, s.close())
+	}()
+
+	useCase := di.MustGetService[usecase.UserUseCase](s.c)
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "get":
+		id, err := uuidArg(args)
+		if err != nil {
+			return err
+		}
+
+		dto, err := useCase.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(dto)
+	case "create":
+		if len(args) != 2 {
+			return errors.New("expected the name and the email arguments")
+		}
+
+		id, err := useCase.Create(ctx, &usecase.CreateUserDTO{
+			Name:  args[0],
+			Email: args[1],
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(id)
+		return nil
+	case "delete":
+		id, err := uuidArg(args)
+		if err != nil {
+			return err
+		}
+
+		return useCase.Delete(ctx, id)
+	case "reindex":
+		n, err := useCase.Reindex(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(n)
+		return nil
+	default:
+		fmt.Println(userUsage)
+		return fmt.Errorf("%w: %s", ErrUnknownUserCommand, cmd)
+	}
+}
+
+func uuidArg(args []string) (uuid.UUID, error) {
+	if len(args) != 1 {
+		return uuid.Nil, errors.New("expected a single identifier argument")
+	}
+
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid identifier argument: %s", args[0])
+	}
+
+	return id, nil
+}
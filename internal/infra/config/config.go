@@ -1,28 +1,206 @@
 package config
 
+import "time"
+
+// Config is the application config, every field can be overridden by the environment variable
+// named after its YAML path, e.g. DATABASE_MASTER_URL, except for the maps of structs
 type Config struct {
-	DB             DB                   `yaml:"database"`
-	RestServer     RestServer           `yaml:"rest_server"`
-	CreateUserCons CreateUserConsumer   `yaml:"create_user_consumer"`
-	UserCreatedPub UserCreatedPublisher `yaml:"user_created_publisher"`
+	Logging        Logging              `yaml:"logging" env-prefix:"LOGGING_"`
+	DB             DB                   `yaml:"database" env-prefix:"DATABASE_"`
+	Redis          Redis                `yaml:"redis" env-prefix:"REDIS_"`
+	Cache          Cache                `yaml:"cache" env-prefix:"CACHE_"`
+	RestServer     RestServer           `yaml:"rest_server" env-prefix:"REST_SERVER_"`
+	Auth           Auth                 `yaml:"auth" env-prefix:"AUTH_"`
+	RateLimit      RateLimit            `yaml:"rate_limit" env-prefix:"RATE_LIMIT_"`
+	Health         Health               `yaml:"health" env-prefix:"HEALTH_"`
+	Tracing        Tracing              `yaml:"tracing" env-prefix:"TRACING_"`
+	Shutdown       Shutdown             `yaml:"shutdown" env-prefix:"SHUTDOWN_"`
+	CreateUserCons CreateUserConsumer   `yaml:"create_user_consumer" env-prefix:"CREATE_USER_CONSUMER_"`
+	UserCreatedPub UserCreatedPublisher `yaml:"user_created_publisher" env-prefix:"USER_CREATED_PUBLISHER_"`
+	Features       map[string]bool      `yaml:"features" env:"FEATURES"`
+	Reload         Reload               `yaml:"reload" env-prefix:"RELOAD_"`
+}
+
+// Logging configures the logger, the levels are one of debug, info, warn and error
+// and Modules override the level of the operations set with sl.Op and the logger groups
+type Logging struct {
+	Level     string            `yaml:"level" env:"LEVEL" env-default:"info" validate:"oneof=debug info warn error"`
+	Format    string            `yaml:"format" env:"FORMAT" env-default:"json" validate:"oneof=json text"`
+	AddSource bool              `yaml:"add_source" env:"ADD_SOURCE"`
+	Modules   map[string]string `yaml:"modules" env:"MODULES" validate:"dive,oneof=debug info warn error"`
+	Sampling  LogSampling       `yaml:"sampling" env-prefix:"SAMPLING_"`
+	Redact    LogRedact         `yaml:"redact" env-prefix:"REDACT_"`
+}
+
+// LogSampling logs the First records with the same level and message within every Tick
+// and then only every Thereafter-th of them, warnings and errors are never sampled
+type LogSampling struct {
+	Enabled    bool          `yaml:"enabled" env:"ENABLED"`
+	First      int           `yaml:"first" env:"FIRST" env-default:"100" validate:"gte=0"`
+	Thereafter int           `yaml:"thereafter" env:"THEREAFTER" env-default:"100" validate:"gte=0"`
+	Tick       time.Duration `yaml:"tick" env:"TICK" env-default:"1s" validate:"gt=0"`
+}
+
+// LogRedact configures the personal data redaction, Mode is mask or hash and the hashes are keyed with HashKey,
+// as the short values like emails and phones can be brute-forced from their plain hashes
+type LogRedact struct {
+	Keys    []string `yaml:"keys" env:"KEYS" env-default:"name,email,phone,password,token,authorization"`
+	Mode    string   `yaml:"mode" env:"MODE" env-default:"mask" validate:"oneof=mask hash"`
+	HashKey string   `yaml:"hash_key" env:"HASH_KEY" validate:"required_if=Mode hash" secret:"true"`
+}
+
+// Redis configures the Redis client, Mode is one of standalone, sentinel and cluster and Addrs are
+// the server, the sentinels or the cluster seed nodes addresses, the cluster supports only the DB 0.
+// The zero pool sizes and timeouts leave the client defaults
+type Redis struct {
+	Mode             string        `yaml:"mode" env:"MODE" env-default:"standalone" validate:"oneof=standalone sentinel cluster"`
+	Addrs            []string      `yaml:"addresses" env:"ADDRESSES" env-default:"localhost:6379" validate:"required,dive,hostname_port"`
+	MasterName       string        `yaml:"master_name" env:"MASTER_NAME" validate:"required_if=Mode sentinel"`
+	Username         string        `yaml:"username" env:"USERNAME"`
+	Password         string        `yaml:"password" env:"PASSWORD" secret:"true"`
+	SentinelUsername string        `yaml:"sentinel_username" env:"SENTINEL_USERNAME"`
+	SentinelPassword string        `yaml:"sentinel_password" env:"SENTINEL_PASSWORD" secret:"true"`
+	DB               int           `yaml:"db" env:"DB" validate:"gte=0,excluded_if=Mode cluster"`
+	PoolSize         int           `yaml:"pool_size" env:"POOL_SIZE" validate:"gte=0"`
+	MinIdleConns     int           `yaml:"min_idle_conns" env:"MIN_IDLE_CONNS" validate:"gte=0"`
+	MaxIdleConns     int           `yaml:"max_idle_conns" env:"MAX_IDLE_CONNS" validate:"gte=0"`
+	DialTimeout      time.Duration `yaml:"dial_timeout" env:"DIAL_TIMEOUT" validate:"gte=0"`
+	ReadTimeout      time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" validate:"gte=0"`
+	WriteTimeout     time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" validate:"gte=0"`
+	PoolTimeout      time.Duration `yaml:"pool_timeout" env:"POOL_TIMEOUT" validate:"gte=0"`
+	TLS              TLS           `yaml:"tls" env-prefix:"TLS_"`
+}
+
+// TLS configures the client TLS, the system roots are trusted if CAFile is empty
+// and CertFile with KeyFile is the client certificate, if any
+type TLS struct {
+	Enabled            bool   `yaml:"enabled" env:"ENABLED"`
+	CAFile             string `yaml:"ca_file" env:"CA_FILE" validate:"omitempty,file"`
+	CertFile           string `yaml:"cert_file" env:"CERT_FILE" validate:"required_with=KeyFile,omitempty,file"`
+	KeyFile            string `yaml:"key_file" env:"KEY_FILE" validate:"required_with=CertFile,omitempty,file"`
+	ServerName         string `yaml:"server_name" env:"SERVER_NAME"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"INSECURE_SKIP_VERIFY"`
+}
+
+// Cache configures the cache, Expiration applies to the values cached without one and zero means no expiration
+type Cache struct {
+	Expiration time.Duration `yaml:"expiration" env:"EXPIRATION" validate:"gte=0"`
 }
 
+// RestServer configures the REST server, BodyLimit is the maximum size in bytes of the request bodies
+// except for the streamed imports
 type RestServer struct {
-	Addr string `yaml:"address"`
+	Addr            string `yaml:"address" env:"ADDRESS" validate:"hostname_port"`
+	BodyLimit       int    `yaml:"body_limit" env:"BODY_LIMIT" env-default:"4194304" validate:"gt=0"`
+	MaxBatchSize    int    `yaml:"max_batch_size" env:"MAX_BATCH_SIZE" env-default:"1000" validate:"gt=0"`
+	ImportBatchSize int    `yaml:"import_batch_size" env:"IMPORT_BATCH_SIZE" env-default:"500" validate:"gt=0"`
+}
+
+// Auth configures the JWT verification, at least one key source must be set.
+// HMACSecret signs the tokens as well, so it must be a long random value set through the environment
+type Auth struct {
+	Issuer        string `yaml:"issuer" env:"ISSUER"`
+	Audience      string `yaml:"audience" env:"AUDIENCE"`
+	HMACSecret    string `yaml:"hmac_secret" env:"HMAC_SECRET" validate:"required_without_all=PublicKeyFile JWKSFile,omitempty,min=32,not_placeholder" secret:"true"`
+	PublicKeyFile string `yaml:"public_key_file" env:"PUBLIC_KEY_FILE" validate:"omitempty,file"`
+	JWKSFile      string `yaml:"jwks_file" env:"JWKS_FILE" validate:"omitempty,file"`
+}
+
+// RateLimit configures the REST routes rate limits, the routes are named as "METHOD /path"
+// with the OpenAPI path relative to the API root, e.g. "POST /users" or "GET /users/{id}"
+type RateLimit struct {
+	Enabled     bool                      `yaml:"enabled" env:"ENABLED"`
+	RedisPrefix string                    `yaml:"redis_prefix" env:"REDIS_PREFIX" env-default:"rate_limit:"`
+	Default     *RouteRateLimit           `yaml:"default" validate:"omitempty"`
+	Routes      map[string]RouteRateLimit `yaml:"routes" validate:"dive"`
+}
+
+// RouteRateLimit allows Requests per Period with at most Burst requests at once,
+// Burst defaults to Requests, Key is one of ip, api_key and principal,
+// the ip limits are checked before the authentication and the others after it
+type RouteRateLimit struct {
+	Requests int           `yaml:"requests" validate:"gt=0"`
+	Period   time.Duration `yaml:"period" validate:"gt=0"`
+	Burst    int           `yaml:"burst" validate:"gte=0"`
+	Key      string        `yaml:"key" validate:"omitempty,oneof=ip api_key principal"`
+}
+
+// Health configures the liveness and readiness checks
+type Health struct {
+	Timeout  time.Duration `yaml:"timeout" env:"TIMEOUT" env-default:"2s" validate:"gt=0"`
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"CACHE_TTL" env-default:"5s" validate:"gte=0"`
+}
+
+// Tracing configures the span export, Exporter is one of none, otlp, stdout and file,
+// Endpoint is the OTLP/HTTP collector host:port and File is the file the spans are appended to
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"EXPORTER" env-default:"none" validate:"oneof=none otlp stdout file"`
+	Endpoint    string  `yaml:"endpoint" env:"ENDPOINT" validate:"required_if=Exporter otlp,omitempty,hostname_port"`
+	Insecure    bool    `yaml:"insecure" env:"INSECURE"`
+	File        string  `yaml:"file" env:"FILE" env-default:"traces.jsonl"`
+	ServiceName string  `yaml:"service_name" env:"SERVICE_NAME" env-default:"lure" validate:"required"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"SAMPLE_RATIO" env-default:"1" validate:"gte=0,lte=1"`
+}
+
+// Shutdown configures the graceful shutdown, Timeout bounds the whole sequence
+// from stopping the REST server to flushing the traces
+type Shutdown struct {
+	Timeout time.Duration `yaml:"timeout" env:"TIMEOUT" env-default:"30s" validate:"gt=0"`
 }
 
 type DB struct {
-	MasterURL string `yaml:"master_url"`
-	SlaveURL  string `yaml:"slave_url"`
+	MasterURL   string `yaml:"master_url" env:"MASTER_URL" validate:"required,url" secret:"url"`
+	SlaveURL    string `yaml:"slave_url" env:"SLAVE_URL" validate:"required,url" secret:"url"`
+	AutoMigrate bool   `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
 }
 
+// CreateUserConsumer configures the consumer, GroupID defaults to the Topic, the group it has always consumed as.
+// StartOffset is first or last and applies to the group without committed offsets, so a new GroupID replays
+// the topic unless the offsets are copied to it first. Zero CommitInterval commits every handled message synchronously
 type CreateUserConsumer struct {
-	Brokers []string `yaml:"brokers"`
-	Topic   string   `yaml:"topic"`
-	GroupID string   `yaml:"group_id"`
+	Brokers        []string      `yaml:"brokers" env:"BROKERS" validate:"required,dive,hostname_port"`
+	Topic          string        `yaml:"topic" env:"TOPIC" validate:"required"`
+	GroupID        string        `yaml:"group_id" env:"GROUP_ID"`
+	Client         KafkaClient   `yaml:"client" env-prefix:"CLIENT_"`
+	MinBytes       int           `yaml:"min_bytes" env:"MIN_BYTES" env-default:"1" validate:"gte=0"`
+	MaxBytes       int           `yaml:"max_bytes" env:"MAX_BYTES" env-default:"10000000" validate:"gtefield=MinBytes"`
+	MaxWait        time.Duration `yaml:"max_wait" env:"MAX_WAIT" env-default:"10s" validate:"gte=0"`
+	CommitInterval time.Duration `yaml:"commit_interval" env:"COMMIT_INTERVAL" validate:"gte=0"`
+	StartOffset    string        `yaml:"start_offset" env:"START_OFFSET" env-default:"first" validate:"oneof=first last"`
 }
 
+// UserCreatedPublisher configures the publisher, the batch is written when it reaches BatchSize messages,
+// BatchBytes or BatchTimeout, RequiredAcks is one of none, one and all
+// and Compression is one of none, gzip, snappy, lz4 and zstd
 type UserCreatedPublisher struct {
-	Brokers []string `yaml:"brokers"`
-	Topic   string   `yaml:"topic"`
+	Brokers      []string      `yaml:"brokers" env:"BROKERS" validate:"required,dive,hostname_port"`
+	Topic        string        `yaml:"topic" env:"TOPIC" validate:"required"`
+	Client       KafkaClient   `yaml:"client" env-prefix:"CLIENT_"`
+	BatchSize    int           `yaml:"batch_size" env:"BATCH_SIZE" env-default:"100" validate:"gt=0"`
+	BatchBytes   int64         `yaml:"batch_bytes" env:"BATCH_BYTES" env-default:"1048576" validate:"gt=0"`
+	BatchTimeout time.Duration `yaml:"batch_timeout" env:"BATCH_TIMEOUT" env-default:"1s" validate:"gt=0"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" env-default:"10s" validate:"gt=0"`
+	RequiredAcks string        `yaml:"required_acks" env:"REQUIRED_ACKS" env-default:"all" validate:"oneof=none one all"`
+	Compression  string        `yaml:"compression" env:"COMPRESSION" env-default:"none" validate:"oneof=none gzip snappy lz4 zstd"`
+}
+
+// KafkaClient configures the connection to the Kafka cluster, ID is the client.id reported to the brokers
+type KafkaClient struct {
+	ID          string        `yaml:"id" env:"ID" env-default:"lure"`
+	DialTimeout time.Duration `yaml:"dial_timeout" env:"DIAL_TIMEOUT" env-default:"10s" validate:"gt=0"`
+	SASL        KafkaSASL     `yaml:"sasl" env-prefix:"SASL_"`
+	TLS         TLS           `yaml:"tls" env-prefix:"TLS_"`
+}
+
+// KafkaSASL configures the SASL authentication, Mechanism is one of none, plain, scram-sha-256 and scram-sha-512
+type KafkaSASL struct {
+	Mechanism string `yaml:"mechanism" env:"MECHANISM" env-default:"none" validate:"oneof=none plain scram-sha-256 scram-sha-512"`
+	Username  string `yaml:"username" env:"USERNAME" validate:"required_unless=Mechanism none"`
+	Password  string `yaml:"password" env:"PASSWORD" validate:"required_unless=Mechanism none" secret:"true"`
+}
+
+// Reload configures the config reloading on SIGHUP and on the config files change,
+// the files are polled every Interval and zero disables the polling
+type Reload struct {
+	Interval time.Duration `yaml:"interval" env:"INTERVAL" env-default:"10s" validate:"gte=0"`
 }
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Source locates the config files
+type Source struct {
+	// Path is the base config file
+	Path string
+
+	// Env is the environment, the config.<env>.yaml file next to the base one overlays it if it exists
+	Env string
+}
+
+// OverlayPath returns the path of the environment config file, it is empty if Env is
+func (src Source) OverlayPath() string {
+	if src.Env == "" {
+		return ""
+	}
+
+	ext := filepath.Ext(src.Path)
+	return strings.TrimSuffix(src.Path, ext) + "." + src.Env + ext
+}
+
+// Load reads the base config file overlaid by the environment one, then overrides the fields
+// by the environment variables and the secrets by the files the <VARIABLE>_FILE variables point to.
+// The result is validated and all the invalid fields are reported at once
+func Load(src Source) (*Config, error) {
+	var cfg Config
+	if err := parseFile(src.Path, &cfg); err != nil {
+		return nil, err
+	}
+
+	if overlay := src.OverlayPath(); overlay != "" {
+		if err := parseFile(overlay, &cfg); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := readSecretFiles(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// parseFile decodes the YAML file onto cfg, so only the fields present in the file are changed
+func parseFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	if err = dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readSecretFiles sets the secrets to the trimmed contents of the files the <VARIABLE>_FILE variables point to
+func readSecretFiles(cfg *Config) error {
+	return walkFields(reflect.ValueOf(cfg).Elem(), "", func(f reflect.Value, sf reflect.StructField, env string) error {
+		if _, ok := sf.Tag.Lookup("secret"); !ok || env == "" {
+			return nil
+		}
+
+		path, ok := os.LookupEnv(env + "_FILE")
+		if !ok {
+			return nil
+		}
+
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("secret file of %s: %w", env, err)
+		}
+		f.SetString(strings.TrimRight(string(secret), "\r\n"))
+
+		return nil
+	})
+}
+
+// walkFields calls fn for every non-struct field of the struct value
+// with the environment variable the field is overridden by, if any
+func walkFields(v reflect.Value, prefix string, fn func(f reflect.Value, sf reflect.StructField, env string) error) error {
+	for i := range v.NumField() {
+		f, sf := v.Field(i), v.Type().Field(i)
+
+		if f.Kind() == reflect.Struct {
+			if err := walkFields(f, prefix+sf.Tag.Get("env-prefix"), fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var env string
+		if name, _, _ := strings.Cut(sf.Tag.Get("env"), ","); name != "" {
+			env = prefix + name
+		}
+
+		if err := fn(f, sf, env); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+)
+
+const masked = "***"
+
+// Masked returns a copy of the config with the fields tagged as secret masked, so it can be printed,
+// the secret:"url" fields have only the password of the URL masked
+func (cfg Config) Masked() Config {
+	_ = walkFields(reflect.ValueOf(&cfg).Elem(), "", func(f reflect.Value, sf reflect.StructField, _ string) error {
+		switch sf.Tag.Get("secret") {
+		case "":
+		case "url":
+			f.SetString(maskURL(f.String()))
+		default:
+			f.SetString(maskSecret(f.String()))
+		}
+
+		return nil
+	})
+
+	return cfg
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return masked
+}
+
+// maskURL masks the password of the URL, an unparsable URL is masked entirely
+func maskURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return maskSecret(raw)
+	}
+
+	return u.Redacted()
+}
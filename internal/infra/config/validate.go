@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var validate = newValidator()
+
+// placeholderSecrets are the well-known values secrets are left with, they are matched case-insensitively
+var placeholderSecrets = []string{"change-me", "changeme", "change_me", "replace-me", "replaceme", "secret", "placeholder"}
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// report the fields by their YAML names
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
+	_ = v.RegisterValidation("not_placeholder", func(fl validator.FieldLevel) bool {
+		value := strings.ToLower(fl.Field().String())
+		for _, placeholder := range placeholderSecrets {
+			if strings.Contains(value, placeholder) {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return v
+}
+
+// Validate checks the config by its "validate" tags and returns ErrInvalidConfig joined with every invalid field
+func (cfg *Config) Validate() error {
+	err := validate.Struct(cfg)
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	errs := make([]error, 0, len(fieldErrs)+1)
+	errs = append(errs, ErrInvalidConfig)
+	for _, fe := range fieldErrs {
+		// the namespace starts with the struct name
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		errs = append(errs, fmt.Errorf("%s %s", field, fieldErrorMessage(fe)))
+	}
+
+	return errors.Join(errs...)
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_if":
+		field, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("is required when %s is %s", snakeCase(field), value)
+	case "required_without_all":
+		fields := strings.Fields(fe.Param())
+		for i, f := range fields {
+			fields[i] = snakeCase(f)
+		}
+
+		return "is required unless any of " + strings.Join(fields, ", ") + " is set"
+	case "required_unless":
+		field, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("is required unless %s is %s", snakeCase(field), value)
+	case "required_with":
+		return "is required when " + snakeCase(fe.Param()) + " is set"
+	case "excluded_if":
+		field, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("must not be set when %s is %s", snakeCase(field), value)
+	case "url":
+		return "must be a valid URL"
+	case "hostname_port":
+		return "must be a host:port address"
+	case "file":
+		return "must be an existing file"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "gtefield":
+		return "must be at least " + snakeCase(fe.Param())
+	case "min":
+		return "must be at least " + fe.Param() + " characters long"
+	case "not_placeholder":
+		return "must not be a placeholder"
+	default:
+		return fmt.Sprintf("failed the %s validation", fe.Tag())
+	}
+}
+
+// snakeCase converts the Go field name referenced by a tag parameter to the YAML name style,
+// e.g. JWKSFile to jwks_file
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var sb strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+
+	return sb.String()
+}
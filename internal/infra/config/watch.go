@@ -0,0 +1,263 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Change is a config change a subscriber applies live
+type Change struct {
+	Old, New *Config
+
+	// Keys are the changed keys the subscriber has subscribed to, e.g. "logging.level"
+	Keys []string
+}
+
+// Has reports whether the key or any key nested in it has changed
+func (ch *Change) Has(key string) bool {
+	return slices.ContainsFunc(ch.Keys, func(changed string) bool {
+		return covers(key, changed)
+	})
+}
+
+// ApplyFunc applies the change live
+type ApplyFunc func(ch *Change) error
+
+type subscription struct {
+	keys  []string
+	apply ApplyFunc
+}
+
+// Watcher reloads the config on SIGHUP and on the config files change and notifies the subscribers.
+// The changes of the keys no subscriber applies live are unsafe, they are rejected with a warning
+// and the previous values are kept until the restart. The changes a subscriber fails to apply
+// keep their previous values as well, so they are retried on the next reload.
+type Watcher struct {
+	log *slog.Logger
+	src Source
+
+	mu     sync.Mutex
+	cfg    *Config
+	subs   []subscription
+	stamps map[string]fileStamp
+}
+
+func NewWatcher(log *slog.Logger, src Source, cfg *Config) *Watcher {
+	w := &Watcher{
+		log: log.With(sl.Op("config.Watcher")),
+		src: src,
+		cfg: cfg,
+	}
+	w.stamps = w.stampFiles()
+
+	return w
+}
+
+// Subscribe registers the function applying the changes of the keys,
+// a key covers the keys nested in it, e.g. "logging" covers "logging.level"
+func (w *Watcher) Subscribe(apply ApplyFunc, keys ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subs = append(w.subs, subscription{
+		keys:  keys,
+		apply: apply,
+	})
+}
+
+// Config returns the current config
+func (w *Watcher) Config() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.cfg
+}
+
+// Run reloads the config on SIGHUP and on the config files change polled every interval until the context is done,
+// zero interval disables the polling
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			w.log.InfoContext(ctx, "reloading config on SIGHUP")
+		case <-tick:
+			if !w.filesChanged() {
+				continue
+			}
+			w.log.InfoContext(ctx, "reloading changed config files")
+		}
+
+		// the failure is logged and the current config is kept
+		_ = w.Reload(ctx)
+	}
+}
+
+// Reload loads and validates the config, rejects the unsafe changes and notifies the subscribers
+func (w *Watcher) Reload(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next, err := Load(w.src)
+	if err != nil {
+		w.log.WarnContext(ctx, "could not reload config", sl.Err(err))
+		return err
+	}
+
+	var changed, rejected []string
+	// revert restores the previous values of the changed keys
+	revert := make(map[string]func())
+	diffFields(reflect.ValueOf(w.cfg).Elem(), reflect.ValueOf(next).Elem(), "", func(key string, prev, cur reflect.Value) {
+		if !w.subscribed(key) {
+			rejected = append(rejected, key)
+			cur.Set(prev)
+			return
+		}
+
+		changed = append(changed, key)
+		revert[key] = func() {
+			cur.Set(prev)
+		}
+	})
+
+	if len(rejected) > 0 {
+		w.log.WarnContext(ctx, "rejected config changes that need a restart", slog.Any("keys", rejected))
+	}
+
+	if len(changed) == 0 {
+		w.log.InfoContext(ctx, "config has no changes to apply")
+		return nil
+	}
+
+	var errs []error
+	var failed []string
+	for _, sub := range w.subs {
+		ch := &Change{
+			Old: w.cfg,
+			New: next,
+		}
+		for _, key := range changed {
+			if slices.ContainsFunc(sub.keys, func(subKey string) bool { return covers(subKey, key) }) {
+				ch.Keys = append(ch.Keys, key)
+			}
+		}
+
+		if len(ch.Keys) == 0 {
+			continue
+		}
+
+		if err = sub.apply(ch); err != nil {
+			w.log.ErrorContext(ctx, "could not apply config change", slog.Any("keys", ch.Keys), sl.Err(err))
+			errs = append(errs, err)
+			failed = append(failed, ch.Keys...)
+		}
+	}
+
+	// the failed changes are reverted after all the subscribers are notified, so they all see the same config
+	for _, key := range failed {
+		revert[key]()
+	}
+	changed = slices.DeleteFunc(changed, func(key string) bool {
+		return slices.Contains(failed, key)
+	})
+
+	w.cfg = next
+	w.log.InfoContext(ctx, "config reloaded", slog.Any("keys", changed))
+
+	return errors.Join(errs...)
+}
+
+func (w *Watcher) subscribed(key string) bool {
+	for _, sub := range w.subs {
+		for _, subKey := range sub.keys {
+			if covers(subKey, key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// covers reports whether the key is equal to the parent or nested in it
+func covers(parent, key string) bool {
+	return key == parent || strings.HasPrefix(key, parent+".")
+}
+
+// diffFields calls fn with the YAML path of every non-struct field differing between the struct values
+func diffFields(prev, cur reflect.Value, prefix string, fn func(key string, prev, cur reflect.Value)) {
+	for i := range prev.NumField() {
+		name, _, _ := strings.Cut(prev.Type().Field(i).Tag.Get("yaml"), ",")
+		key := prefix + name
+
+		prevF, curF := prev.Field(i), cur.Field(i)
+		if prevF.Kind() == reflect.Struct {
+			diffFields(prevF, curF, key+".", fn)
+			continue
+		}
+
+		if !reflect.DeepEqual(prevF.Interface(), curF.Interface()) {
+			fn(key, prevF, curF)
+		}
+	}
+}
+
+// fileStamp identifies the version of a config file, the zero stamp is a missing file
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+func (w *Watcher) stampFiles() map[string]fileStamp {
+	paths := []string{w.src.Path}
+	if overlay := w.src.OverlayPath(); overlay != "" {
+		paths = append(paths, overlay)
+	}
+
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{info.ModTime().UnixNano(), info.Size()}
+		} else {
+			stamps[path] = fileStamp{}
+		}
+	}
+
+	return stamps
+}
+
+// filesChanged reports whether any config file has changed, appeared or disappeared since the last call
+func (w *Watcher) filesChanged() bool {
+	stamps := w.stampFiles()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := !maps.Equal(stamps, w.stamps)
+	w.stamps = stamps
+
+	return changed
+}
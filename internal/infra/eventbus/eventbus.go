@@ -4,20 +4,36 @@ import (
 	"context"
 	"errors"
 	"github.com/akimsavvin/test_go/internal/usecase"
+	"go.opentelemetry.io/otel"
 	"log/slog"
 	"reflect"
+	"time"
 )
 
 var (
 	ErrEventNotRegistered = errors.New("event is not registered")
 )
 
+var tracer = otel.Tracer("github.com/akimsavvin/test_go/internal/infra/eventbus")
+
 type Publisher[TEvent any] interface {
 	Publish(ctx context.Context, event TEvent) error
 }
 
+// Observer observes the published events, err is nil on success
+type Observer interface {
+	ObservePublish(event string, d time.Duration, err error)
+}
+
 type Option func(*EventBus)
 
+// WithObserver reports the published events to the observer
+func WithObserver(obs Observer) Option {
+	return func(bus *EventBus) {
+		bus.obs = obs
+	}
+}
+
 func WithEventPublisher[TEvent any](pub Publisher[TEvent]) Option {
 	return func(bus *EventBus) {
 		bus.pubs[reflect.TypeFor[TEvent]()] = reflect.ValueOf(pub.Publish)
@@ -27,6 +43,7 @@ func WithEventPublisher[TEvent any](pub Publisher[TEvent]) Option {
 type EventBus struct {
 	log  *slog.Logger
 	pubs map[reflect.Type]reflect.Value
+	obs  Observer
 }
 
 var _ usecase.EventBus = (*EventBus)(nil)
@@ -45,13 +62,31 @@ func New(log *slog.Logger, opts ...Option) *EventBus {
 }
 
 func (bus *EventBus) Publish(ctx context.Context, event any) error {
-	pubFunc, ok := bus.pubs[reflect.TypeOf(event)]
+	typ := reflect.TypeOf(event)
+	pubFunc, ok := bus.pubs[typ]
 	if !ok {
 		return ErrEventNotRegistered
 	}
 
-	return pubFunc.Call([]reflect.Value{
+	start := time.Now()
+	// the nil error is a nil interface, so it is not asserted
+	err, _ := pubFunc.Call([]reflect.Value{
 		reflect.ValueOf(ctx),
 		reflect.ValueOf(event),
 	})[0].Interface().(error)
+
+	if bus.obs != nil {
+		bus.obs.ObservePublish(eventName(typ), time.Since(start), err)
+	}
+
+	return err
+}
+
+// eventName returns the name of the event type without the pointer
+func eventName(typ reflect.Type) string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	return typ.Name()
 }
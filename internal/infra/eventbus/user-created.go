@@ -5,7 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/akimsavvin/test_go/internal/domain"
+	"github.com/akimsavvin/test_go/pkg/otelkafka"
+	"github.com/akimsavvin/test_go/pkg/sl"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
 )
 
@@ -29,9 +34,29 @@ func (pub *UserCreatedEventPublisher) Publish(ctx context.Context, event *domain
 		return fmt.Errorf("error marshalling event: %w", err)
 	}
 
+	ctx, span := tracer.Start(ctx, pub.w.Topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(pub.w.Topic),
+		),
+	)
+	defer span.End()
+
 	key, _ := event.ID.MarshalText()
-	return pub.w.WriteMessages(context.Background(), kafka.Message{
+	msg := kafka.Message{
 		Key:   key,
 		Value: bytes,
-	})
+	}
+	otelkafka.Inject(ctx, &msg)
+	sl.InjectIDs(ctx, otelkafka.NewHeaderCarrier(&msg))
+
+	if err = pub.w.WriteMessages(context.Background(), msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	return nil
 }
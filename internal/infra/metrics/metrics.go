@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/akimsavvin/test_go/internal/infra/eventbus"
+	"github.com/akimsavvin/test_go/internal/infra/storage"
+	"github.com/akimsavvin/test_go/internal/presentation/kfk"
+	"github.com/akimsavvin/test_go/internal/presentation/rest"
+	"github.com/akimsavvin/test_go/pkg/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "lure"
+
+const (
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+// Metrics collects the application metrics into its own registry
+type Metrics struct {
+	reg *prometheus.Registry
+
+	httpDuration *prometheus.HistogramVec
+
+	workTotal    *prometheus.CounterVec
+	workDuration *prometheus.HistogramVec
+
+	cacheOps *prometheus.CounterVec
+
+	consumedTotal *prometheus.CounterVec
+	consumerLag   *prometheus.GaugeVec
+
+	publishedTotal  *prometheus.CounterVec
+	publishDuration *prometheus.HistogramVec
+}
+
+var (
+	_ rest.HTTPObserver    = (*Metrics)(nil)
+	_ storage.WorkObserver = (*Metrics)(nil)
+	_ cache.Observer       = (*Metrics)(nil)
+	_ kfk.ConsumerObserver = (*Metrics)(nil)
+	_ eventbus.Observer    = (*Metrics)(nil)
+)
+
+func New() (*Metrics, error) {
+	m := &Metrics{
+		reg: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the HTTP requests by route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		workTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "unit_of_work",
+			Name:      "total",
+			Help:      "Number of the finished units of work by kind and outcome.",
+		}, []string{"kind", "outcome"}),
+		workDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "unit_of_work",
+			Name:      "duration_seconds",
+			Help:      "Duration of the units of work from start to commit or rollback.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"kind", "outcome"}),
+		cacheOps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "operations_total",
+			Help:      "Number of the cache operations by result.",
+		}, []string{"op", "result"}),
+		consumedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "consumed_messages_total",
+			Help:      "Number of the consumed messages by consumer and result.",
+		}, []string{"consumer", "result"}),
+		consumerLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "consumer_lag",
+			Help:      "Number of the messages behind the last consumed one.",
+		}, []string{"consumer"}),
+		publishedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "eventbus",
+			Name:      "published_events_total",
+			Help:      "Number of the published events by event and result.",
+		}, []string{"event", "result"}),
+		publishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "eventbus",
+			Name:      "publish_duration_seconds",
+			Help:      "Duration of the event publishing.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"event"}),
+	}
+
+	collectorsToRegister := []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.workTotal,
+		m.workDuration,
+		m.cacheOps,
+		m.consumedTotal,
+		m.consumerLag,
+		m.publishedTotal,
+		m.publishDuration,
+	}
+	for _, c := range collectorsToRegister {
+		if err := m.reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// RegisterDB exposes the connection pool stats of the database labeled with name
+func (m *Metrics) RegisterDB(name string, db *sql.DB) error {
+	return m.reg.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.reg, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, d time.Duration) {
+	m.httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+func (m *Metrics) ObserveWork(kind, outcome string, d time.Duration) {
+	m.workTotal.WithLabelValues(kind, outcome).Inc()
+	m.workDuration.WithLabelValues(kind, outcome).Observe(d.Seconds())
+}
+
+func (m *Metrics) ObserveCache(op, result string) {
+	m.cacheOps.WithLabelValues(op, result).Inc()
+}
+
+func (m *Metrics) ObserveMessage(consumer string, lag int64, err error) {
+	m.consumedTotal.WithLabelValues(consumer, result(err)).Inc()
+	if lag >= 0 {
+		m.consumerLag.WithLabelValues(consumer).Set(float64(lag))
+	}
+}
+
+func (m *Metrics) ObservePublish(event string, d time.Duration, err error) {
+	m.publishedTotal.WithLabelValues(event, result(err)).Inc()
+	m.publishDuration.WithLabelValues(event).Observe(d.Seconds())
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultError
+	}
+
+	return resultOK
+}
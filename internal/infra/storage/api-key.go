@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/efgo"
+	"github.com/akimsavvin/test_go/internal/domain"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/changetracker"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/google/uuid"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type apiKeySnapshot struct {
+	ID         uuid.UUID    `db:"id"`
+	CreatedAt  time.Time    `db:"created_at"`
+	Name       string       `db:"name"`
+	KeyHash    string       `db:"key_hash"`
+	Scopes     string       `db:"scopes"`
+	ExpiresAt  sql.NullTime `db:"expires_at"`
+	RevokedAt  sql.NullTime `db:"revoked_at"`
+	LastUsedAt sql.NullTime `db:"last_used_at"`
+}
+
+func apiKeyFromSnapshot(snap *apiKeySnapshot) *domain.APIKey {
+	return domain.NewAPIKey(
+		snap.ID,
+		snap.CreatedAt,
+		snap.Name,
+		snap.KeyHash,
+		strings.Fields(snap.Scopes),
+		snap.ExpiresAt.Time,
+		snap.RevokedAt.Time,
+		snap.LastUsedAt.Time,
+	)
+}
+
+// nullTime maps the zero time to NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func nullTimeEqual(a, b sql.NullTime) bool {
+	return a.Valid == b.Valid && a.Time.Equal(b.Time)
+}
+
+// apiKeyEntity registers domain.APIKey in the change tracker, only the mutable columns are diffed
+func apiKeyEntity() changetracker.Option {
+	return changetracker.WithEntity(
+		func(key *domain.APIKey) any {
+			return key.ID()
+		},
+		changetracker.AccessorDiff(
+			changetracker.FieldFunc("revoked_at", func(key *domain.APIKey) sql.NullTime {
+				return nullTime(key.RevokedAt())
+			}, nullTimeEqual),
+			changetracker.FieldFunc("last_used_at", func(key *domain.APIKey) sql.NullTime {
+				return nullTime(key.LastUsedAt())
+			}, nullTimeEqual),
+		),
+	)
+}
+
+type APIKeyRepo struct {
+	log  *slog.Logger
+	qx   QueryExec
+	coll *changetracker.EntityCollection[domain.APIKey]
+}
+
+var (
+	_ usecase.APIKeyRepo      = (*APIKeyRepo)(nil)
+	_ usecase.APIKeyUsageRepo = (*APIKeyRepo)(nil)
+)
+
+func NewAPIKeyRepo(log *slog.Logger, qx QueryExec, ct *changetracker.ChangeTracker) *APIKeyRepo {
+	repo := &APIKeyRepo{
+		log: log.With(sl.Op("APIKeyRepo")),
+		qx:  qx,
+	}
+
+	if ct != nil {
+		repo.coll = changetracker.Entity[domain.APIKey](ct)
+	}
+
+	return repo
+}
+
+func (repo *APIKeyRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.APIKey, error) {
+	if repo.coll != nil {
+		if key, ok := repo.coll.Find(id); ok {
+			return key, nil
+		}
+	}
+
+	query := `SELECT id, created_at, name, key_hash, scopes, expires_at, revoked_at, last_used_at
+			  FROM api_keys WHERE id = $1;`
+
+	return repo.get(ctx, query, id)
+}
+
+func (repo *APIKeyRepo) GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	query := `SELECT id, created_at, name, key_hash, scopes, expires_at, revoked_at, last_used_at
+			  FROM api_keys WHERE key_hash = $1;`
+
+	return repo.get(ctx, query, keyHash)
+}
+
+func (repo *APIKeyRepo) get(ctx context.Context, query string, arg any) (*domain.APIKey, error) {
+	snap, err := efgo.QueryRowContext[apiKeySnapshot](ctx, repo.qx, query, arg)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrAPIKeyNotFound
+		}
+
+		return nil, err
+	}
+
+	key := apiKeyFromSnapshot(snap)
+	if repo.coll != nil {
+		key = repo.coll.Track(key)
+	}
+
+	return key, nil
+}
+
+// Insert adds the API key to be inserted on UnitOfWork.Save
+func (repo *APIKeyRepo) Insert(ctx context.Context, key *domain.APIKey) error {
+	if repo.coll == nil {
+		return repo.insert(ctx, key)
+	}
+
+	return repo.coll.Add(key)
+}
+
+// MarkUsed sets the last usage time of the API key unless a later one is already set,
+// it is written at once and not tracked
+func (repo *APIKeyRepo) MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	log := repo.log.With(slog.String("api_key_id", id.String()))
+
+	query := `UPDATE api_keys SET last_used_at = $2
+			  WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2);`
+
+	if _, err := repo.qx.ExecContext(ctx, query, id, at); err != nil {
+		log.ErrorContext(ctx, "could not mark api key used", sl.Err(err))
+		return err
+	}
+	log.DebugContext(ctx, "marked api key used")
+
+	return nil
+}
+
+func (repo *APIKeyRepo) beforeSave() error {
+	return repo.coll.BeforeSave()
+}
+
+func (repo *APIKeyRepo) flushInserts(ctx context.Context) error {
+	for _, key := range repo.coll.Added() {
+		if err := repo.insert(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *APIKeyRepo) flushUpdates(ctx context.Context) error {
+	for _, changes := range repo.coll.Changes() {
+		if err := repo.update(ctx, changes.Entity, changes.Fields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushDeletes does nothing, the API keys are revoked instead of being deleted
+func (repo *APIKeyRepo) flushDeletes(context.Context) error {
+	return nil
+}
+
+func (repo *APIKeyRepo) acceptChanges() {
+	repo.coll.AcceptChanges()
+}
+
+func (repo *APIKeyRepo) insert(ctx context.Context, key *domain.APIKey) error {
+	log := repo.log.With(slog.String("api_key_id", key.ID().String()))
+
+	query := `INSERT INTO api_keys (id, created_at, name, key_hash, scopes, expires_at, revoked_at, last_used_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	log.DebugContext(ctx, "inserting into api keys")
+
+	_, err := repo.qx.ExecContext(ctx, query,
+		key.ID(),
+		key.CreatedAt(),
+		key.Name(),
+		key.KeyHash(),
+		strings.Join(key.Scopes(), " "),
+		nullTime(key.ExpiresAt()),
+		nullTime(key.RevokedAt()),
+		nullTime(key.LastUsedAt()),
+	)
+	if err != nil {
+		log.ErrorContext(ctx, "could not insert into api keys", sl.Err(err))
+		return err
+	}
+	log.InfoContext(ctx, "inserted into api keys")
+
+	return nil
+}
+
+func (repo *APIKeyRepo) update(ctx context.Context, key *domain.APIKey, changes []changetracker.FieldChange) error {
+	log := repo.log.With(slog.String("api_key_id", key.ID().String()))
+
+	set := make([]string, 0, len(changes))
+	args := make([]any, 0, len(changes)+1)
+	for i, ch := range changes {
+		set = append(set, fmt.Sprintf("%s = $%d", ch.Field, i+1))
+		args = append(args, ch.New)
+	}
+	args = append(args, key.ID())
+
+	query := fmt.Sprintf(`UPDATE api_keys SET %s WHERE id = $%d;`, strings.Join(set, ", "), len(args))
+	log.DebugContext(ctx, "updating in api keys", slog.String("query", query))
+
+	if _, err := repo.qx.ExecContext(ctx, query, args...); err != nil {
+		log.ErrorContext(ctx, "could not update in api keys", sl.Err(err))
+		return err
+	}
+	log.InfoContext(ctx, "updated in api keys")
+
+	return nil
+}
@@ -1,28 +1,177 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"github.com/akimsavvin/test_go/migrations"
+	"github.com/akimsavvin/test_go/pkg/sl"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/pgx"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"io/fs"
+	"log/slog"
 )
 
-func Migrate(db *sql.DB) error {
+// migrateLockID is the Postgres advisory lock key held while migrating on startup
+const migrateLockID int64 = 0x6c757265 // "lure"
+
+// MigrationStatus is the state of a single migration
+type MigrationStatus struct {
+	Version uint
+	Applied bool
+	Current bool
+}
+
+// Migrator applies the embedded migrations to the database
+type Migrator struct {
+	src source.Driver
+	m   *migrate.Migrate
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, err
+	}
+
 	driver, err := pgx.WithInstance(db, &pgx.Config{
 		MigrationsTable: "migrations",
 	})
 	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "pgx", driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		src: src,
+		m:   m,
+	}, nil
+}
+
+// Up applies all the pending migrations
+func (mig *Migrator) Up() error {
+	return ignoreNoChange(mig.m.Up())
+}
+
+// Down rolls back n applied migrations
+func (mig *Migrator) Down(n int) error {
+	return ignoreNoChange(mig.m.Steps(-n))
+}
+
+// Goto migrates up or down to the given version
+func (mig *Migrator) Goto(version uint) error {
+	return ignoreNoChange(mig.m.Migrate(version))
+}
+
+// Force sets the version without running migrations and clears the dirty flag
+func (mig *Migrator) Force(version int) error {
+	return mig.m.Force(version)
+}
+
+// Version returns the current version, zero if no migration has been applied
+func (mig *Migrator) Version() (version uint, dirty bool, err error) {
+	version, dirty, err = mig.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+// Status returns the status of every embedded migration
+func (mig *Migrator) Status() ([]MigrationStatus, error) {
+	current, _, err := mig.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []MigrationStatus
+	version, err := mig.src.First()
+	for err == nil {
+		res = append(res, MigrationStatus{
+			Version: version,
+			Applied: version <= current,
+			Current: version == current,
+		})
+
+		version, err = mig.src.Next(version)
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Close closes the migration source and the database
+func (mig *Migrator) Close() error {
+	srcErr, dbErr := mig.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+
+	return err
+}
+
+// Migrate applies all the pending migrations to the database at the url holding an advisory lock,
+// so only one replica migrates the database at a time. It uses its own connection pool,
+// as closing the migrator closes the database
+func Migrate(ctx context.Context, log *slog.Logger, url string) (err error) {
+	log = log.With(sl.Op("storage.Migrate"))
+
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return err
+	}
+
+	// the migrator closes the database, closing it is idempotent
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.DebugContext(ctx, "acquiring migration lock")
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrateLockID); err != nil {
+		log.ErrorContext(ctx, "could not acquire migration lock", sl.Err(err))
 		return err
 	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrateLockID); err != nil {
+			log.ErrorContext(ctx, "could not release migration lock", sl.Err(err))
+		}
+	}()
 
-	m, err := migrate.NewWithDatabaseInstance("file://migrations", "pgx", driver)
+	mig, err := NewMigrator(db)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if closeErr := mig.Close(); closeErr != nil {
+			log.ErrorContext(ctx, "could not close migrator", sl.Err(closeErr))
+			err = errors.Join(err, closeErr)
+		}
+	}()
 
-	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	log.DebugContext(ctx, "migrating database")
+	if err = mig.Up(); err != nil {
+		log.ErrorContext(ctx, "could not migrate database", sl.Err(err))
 		return err
 	}
 
+	log.InfoContext(ctx, "migrated database")
 	return nil
 }
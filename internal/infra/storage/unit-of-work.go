@@ -4,22 +4,95 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/akimsavvin/test_go/internal/domain"
 	"github.com/akimsavvin/test_go/internal/usecase"
 	"github.com/akimsavvin/test_go/pkg/changetracker"
 	"github.com/akimsavvin/test_go/pkg/sl"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
+	"time"
 )
 
+// Work outcomes reported to WorkObserver
+const (
+	WorkCommit   = "commit"
+	WorkRollback = "rollback"
+	WorkError    = "error"
+)
+
+// WorkObserver observes the finished units of work, kind is read or write
+type WorkObserver interface {
+	ObserveWork(kind, outcome string, d time.Duration)
+}
+
+var tracer = otel.Tracer("github.com/akimsavvin/test_go/internal/infra/storage")
+
+// workTrace ends the span of a unit of work and reports its outcome to the observer, if any
+type workTrace struct {
+	obs   WorkObserver
+	span  trace.Span
+	kind  string
+	start time.Time
+}
+
+func startWorkTrace(ctx context.Context, obs WorkObserver, kind string) (context.Context, workTrace) {
+	ctx, span := tracer.Start(ctx, "UnitOfWork "+kind,
+		trace.WithAttributes(attribute.String("unit_of_work.kind", kind)),
+	)
+
+	return ctx, workTrace{
+		obs:   obs,
+		span:  span,
+		kind:  kind,
+		start: time.Now(),
+	}
+}
+
+func (wt workTrace) done(outcome string) {
+	if wt.span != nil {
+		wt.span.SetAttributes(attribute.String("unit_of_work.outcome", outcome))
+		if outcome == WorkError {
+			wt.span.SetStatus(codes.Error, outcome)
+		}
+		wt.span.End()
+	}
+
+	if wt.obs != nil {
+		wt.obs.ObserveWork(wt.kind, outcome, time.Since(wt.start))
+	}
+}
+
+// flusher writes the tracked changes of a single entity type
+type flusher interface {
+	beforeSave() error
+	flushInserts(ctx context.Context) error
+	flushUpdates(ctx context.Context) error
+	flushDeletes(ctx context.Context) error
+	acceptChanges()
+}
+
 type UnitOfWork struct {
+	workTrace
+
 	ctx context.Context
 
 	log *slog.Logger
 	tx  *sql.Tx
 
-	userRepo *UserRepo
+	userRepo   *UserRepo
+	apiKeyRepo *APIKeyRepo
 
 	ct *changetracker.ChangeTracker
+
+	// savepoints is the number of the savepoints taken, it names the next one
+	savepoints int
+
+	// flushers are ordered by dependency, the referenced entities go first
+	flushers []flusher
 }
 
 var _ usecase.UnitOfWork = (*UnitOfWork)(nil)
@@ -30,79 +103,172 @@ func NewUnitOfWork(ctx context.Context, log *slog.Logger, tx *sql.Tx) *UnitOfWor
 			func(user *domain.User) any {
 				return user.ID()
 			},
-			func(old *domain.User, current *domain.User) bool {
-				return old.UpdatedAt() != current.UpdatedAt()
-			},
+			changetracker.AccessorDiff(
+				changetracker.Field("created_at", (*domain.User).CreatedAt),
+				changetracker.Field("updated_at", (*domain.User).UpdatedAt),
+				changetracker.Field("name", (*domain.User).Name),
+				changetracker.Field("email", (*domain.User).Email),
+			),
 		),
+		apiKeyEntity(),
 	)
 
-	return &UnitOfWork{
+	unit := &UnitOfWork{
 		ctx: ctx,
 		log: log,
 		tx:  tx,
 		ct:  ct,
 	}
+
+	unit.userRepo = NewUserRepo(log, tx, ct)
+	unit.apiKeyRepo = NewAPIKeyRepo(log, tx, ct)
+	unit.flushers = []flusher{unit.userRepo, unit.apiKeyRepo}
+
+	return unit
 }
 
 func (unit *UnitOfWork) Users() usecase.UserRepo {
-	if unit.userRepo == nil {
-		unit.userRepo = NewUserRepo(unit.log, unit.tx, unit.ct)
+	return unit.userRepo
+}
+
+func (unit *UnitOfWork) APIKeys() usecase.APIKeyRepo {
+	return unit.apiKeyRepo
+}
+
+// flush runs the before save hooks and writes the pending changes: inserts in dependency order,
+// then updates, which do not depend on the order, and then deletes in reverse dependency order
+func (unit *UnitOfWork) flush() error {
+	for _, f := range unit.flushers {
+		if err := f.beforeSave(); err != nil {
+			return err
+		}
 	}
 
-	return unit.userRepo
+	for _, f := range unit.flushers {
+		if err := f.flushInserts(unit.ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range unit.flushers {
+		if err := f.flushUpdates(unit.ctx); err != nil {
+			return err
+		}
+	}
+
+	for i := len(unit.flushers) - 1; i >= 0; i-- {
+		if err := unit.flushers[i].flushDeletes(unit.ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (unit *UnitOfWork) acceptChanges() {
+	for _, f := range unit.flushers {
+		f.acceptChanges()
+	}
+}
+
+func (unit *UnitOfWork) Savepoint(fn func() error) error {
+	log := unit.log.With(sl.Op("Savepoint"))
+
+	if err := unit.flush(); err != nil {
+		log.ErrorContext(unit.ctx, "could not flush unit of work", sl.Err(err))
+		return err
+	}
+	unit.acceptChanges()
+
+	unit.savepoints++
+	name := fmt.Sprintf("sp_%d", unit.savepoints)
+	if _, err := unit.tx.ExecContext(unit.ctx, "SAVEPOINT "+name); err != nil {
+		log.ErrorContext(unit.ctx, "could not create savepoint", sl.Err(err))
+		return err
+	}
+
+	err := fn()
+	if err == nil {
+		err = unit.flush()
+	}
+
+	if err != nil {
+		log.DebugContext(unit.ctx, "rolling back to savepoint", sl.Err(err))
+		unit.ct.Reset()
+
+		if _, rbErr := unit.tx.ExecContext(unit.ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			log.ErrorContext(unit.ctx, "could not roll back to savepoint", sl.Err(rbErr))
+			return errors.Join(err, rbErr)
+		}
+
+		return err
+	}
+	unit.acceptChanges()
+
+	if _, err = unit.tx.ExecContext(unit.ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		log.ErrorContext(unit.ctx, "could not release savepoint", sl.Err(err))
+		return err
+	}
+
+	return nil
 }
 
 func (unit *UnitOfWork) Save() error {
 	log := unit.log.With(sl.Op("Save"))
-	log.Debug("saving unit of work")
+	log.DebugContext(unit.ctx, "saving unit of work")
 
-	var err error
-	usersColl := changetracker.Entity[domain.User](unit.ct)
-	for _, user := range usersColl.Changed() {
-		if err = unit.userRepo.update(unit.ctx, user); err != nil {
-			return err
-		}
+	if err := unit.flush(); err != nil {
+		log.ErrorContext(unit.ctx, "could not flush unit of work", sl.Err(err))
+		return err
 	}
 
-	if err = unit.tx.Commit(); err != nil {
+	if err := unit.tx.Commit(); err != nil {
 		if errors.Is(err, sql.ErrTxDone) {
-			log.Debug("work is already finished")
+			log.DebugContext(unit.ctx, "work is already finished")
 			return nil
 		} else {
-			log.Error("could not save unit of work", sl.Err(err))
+			log.ErrorContext(unit.ctx, "could not save unit of work", sl.Err(err))
+			unit.done(WorkError)
 			return err
 		}
 	}
+	unit.done(WorkCommit)
+	unit.acceptChanges()
 
-	log.Info("saved unit of work")
+	log.InfoContext(unit.ctx, "saved unit of work")
 	return nil
 }
 
 func (unit *UnitOfWork) Cancel() error {
 	log := unit.log.With(sl.Op("Cancel"))
-	log.Debug("cancelling unit of work")
+	log.DebugContext(unit.ctx, "cancelling unit of work")
 
 	if err := unit.tx.Rollback(); err != nil {
 		if errors.Is(err, sql.ErrTxDone) {
-			log.Debug("work is already finished")
+			log.DebugContext(unit.ctx, "work is already finished")
 			return nil
 		} else {
-			log.Error("could not cancel unit of work", sl.Err(err))
+			log.ErrorContext(unit.ctx, "could not cancel unit of work", sl.Err(err))
+			unit.done(WorkError)
 			return err
 		}
 	}
+	unit.done(WorkRollback)
 
-	log.Info("cancelled unit of work back")
+	log.InfoContext(unit.ctx, "cancelled unit of work back")
 	return nil
 }
 
 type UnitOfReadWork struct {
+	workTrace
+
 	ctx context.Context
 
 	log *slog.Logger
 	tx  *sql.Tx
 
-	userRepo *UserRepo
+	userRepo   *UserRepo
+	apiKeyRepo *APIKeyRepo
 }
 
 var _ usecase.UnitOfReadWork = (*UnitOfReadWork)(nil)
@@ -123,20 +289,30 @@ func (unit *UnitOfReadWork) Users() usecase.UserReadRepo {
 	return unit.userRepo
 }
 
+func (unit *UnitOfReadWork) APIKeys() usecase.APIKeyReadRepo {
+	if unit.apiKeyRepo == nil {
+		unit.apiKeyRepo = NewAPIKeyRepo(unit.log, unit.tx, nil)
+	}
+
+	return unit.apiKeyRepo
+}
+
 func (unit *UnitOfReadWork) Save() error {
 	log := unit.log.With(sl.Op("Save"))
 
 	if err := unit.tx.Commit(); err != nil {
 		if errors.Is(err, sql.ErrTxDone) {
-			log.Debug("read work is already finished")
+			log.DebugContext(unit.ctx, "read work is already finished")
 			return nil
 		} else {
-			log.Error("could not save unit of read work", sl.Err(err))
+			log.ErrorContext(unit.ctx, "could not save unit of read work", sl.Err(err))
+			unit.done(WorkError)
 			return err
 		}
 	}
+	unit.done(WorkCommit)
 
-	log.Info("saved unit of read work")
+	log.InfoContext(unit.ctx, "saved unit of read work")
 	return nil
 }
 
@@ -145,15 +321,17 @@ func (unit *UnitOfReadWork) Cancel() error {
 
 	if err := unit.tx.Rollback(); err != nil {
 		if errors.Is(err, sql.ErrTxDone) {
-			log.Debug("read work is already finished")
+			log.DebugContext(unit.ctx, "read work is already finished")
 			return nil
 		} else {
-			log.Error("could not cancel unit of read work", sl.Err(err))
+			log.ErrorContext(unit.ctx, "could not cancel unit of read work", sl.Err(err))
+			unit.done(WorkError)
 			return err
 		}
 	}
+	unit.done(WorkRollback)
 
-	log.Info("canceled unit of read work")
+	log.InfoContext(unit.ctx, "canceled unit of read work")
 	return nil
 }
 
@@ -161,47 +339,73 @@ type UnitOfWorkFactory struct {
 	log    *slog.Logger
 	master *sql.DB
 	slave  *sql.DB
+	obs    WorkObserver
 }
 
 var _ usecase.UnitOfWorkFactory = (*UnitOfWorkFactory)(nil)
 
-func NewUnitOfWorkFactory(log *slog.Logger, master, slave *sql.DB) *UnitOfWorkFactory {
-	return &UnitOfWorkFactory{
+type FactoryOption func(*UnitOfWorkFactory)
+
+// WithWorkObserver reports the outcomes of the started units of work to the observer
+func WithWorkObserver(obs WorkObserver) FactoryOption {
+	return func(factory *UnitOfWorkFactory) {
+		factory.obs = obs
+	}
+}
+
+func NewUnitOfWorkFactory(log *slog.Logger, master, slave *sql.DB, opts ...FactoryOption) *UnitOfWorkFactory {
+	factory := &UnitOfWorkFactory{
 		log:    log,
 		master: master,
 		slave:  slave,
 	}
+
+	for _, opt := range opts {
+		opt(factory)
+	}
+
+	return factory
 }
 
 func (factory *UnitOfWorkFactory) StartWork(ctx context.Context) (usecase.UnitOfWork, error) {
 	log := factory.log.With(sl.Op("StartWork"))
 	log.DebugContext(ctx, "starting new unit of work")
 
+	ctx, wt := startWorkTrace(ctx, factory.obs, "write")
 	tx, err := factory.master.BeginTx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelSerializable,
 	})
 	if err != nil {
 		log.ErrorContext(ctx, "could not start new unit of work", sl.Err(err))
+		wt.done(WorkError)
 		return nil, err
 	}
 
 	log.InfoContext(ctx, "started new unit of work")
-	return NewUnitOfWork(ctx, factory.log, tx), nil
+	unit := NewUnitOfWork(ctx, factory.log, tx)
+	unit.workTrace = wt
+
+	return unit, nil
 }
 
 func (factory *UnitOfWorkFactory) StartReadWork(ctx context.Context) (usecase.UnitOfReadWork, error) {
 	log := factory.log.With(sl.Op("StartReadWork"))
 	log.DebugContext(ctx, "starting new unit of read work")
 
+	ctx, wt := startWorkTrace(ctx, factory.obs, "read")
 	tx, err := factory.slave.BeginTx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelSerializable,
 		ReadOnly:  true,
 	})
 	if err != nil {
 		log.ErrorContext(ctx, "could not start new unit of read work", sl.Err(err))
+		wt.done(WorkError)
 		return nil, err
 	}
 
 	log.InfoContext(ctx, "started new unit of read work")
-	return NewUnitOfReadWork(ctx, log, tx), nil
+	unit := NewUnitOfReadWork(ctx, log, tx)
+	unit.workTrace = wt
+
+	return unit, nil
 }
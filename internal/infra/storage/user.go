@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/akimsavvin/efgo"
 	"github.com/akimsavvin/test_go/internal/domain"
 	"github.com/akimsavvin/test_go/internal/usecase"
@@ -11,6 +12,7 @@ import (
 	"github.com/akimsavvin/test_go/pkg/sl"
 	"github.com/google/uuid"
 	"log/slog"
+	"strings"
 	"time"
 )
 
@@ -36,7 +38,7 @@ var _ usecase.UserRepo = (*UserRepo)(nil)
 
 func NewUserRepo(log *slog.Logger, qx QueryExec, ct *changetracker.ChangeTracker) *UserRepo {
 	repo := &UserRepo{
-		log: log,
+		log: log.With(sl.Op("UserRepo")),
 		qx:  qx,
 	}
 
@@ -48,6 +50,16 @@ func NewUserRepo(log *slog.Logger, qx QueryExec, ct *changetracker.ChangeTracker
 }
 
 func (repo *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	if repo.coll != nil {
+		if user, ok := repo.coll.Find(id); ok {
+			if repo.coll.State(user) == changetracker.Deleted {
+				return nil, domain.ErrUserNotFound
+			}
+
+			return user, nil
+		}
+	}
+
 	query := `SELECT id, created_at, updated_at, name, email FROM users WHERE id = $1;`
 
 	snap, err := efgo.QueryRowContext[userSnapshot](ctx, repo.qx, query, id)
@@ -61,66 +73,185 @@ func (repo *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User,
 
 	user := userFromSnapshot(snap)
 	if repo.coll != nil {
-		repo.coll.Add(user)
+		user = repo.coll.Track(user)
 	}
 
 	return user, nil
 }
 
-func (repo *UserRepo) Insert(ctx context.Context, user *domain.User) error {
-	query := `INSERT INTO users (id, created_at, updated_at, name, email) VALUES ($1, $2, $3, $4, $5);`
-
-	_, err := repo.qx.ExecContext(
-		ctx,
-		query,
-		user.ID(),
-		user.CreatedAt(),
-		user.UpdatedAt(),
-		user.Name(),
-		user.Email())
-	if err != nil {
+// userCursorFetchSize is the number of rows fetched from the cursor at once
+const userCursorFetchSize = 500
+
+// ForEach streams the users through a server-side cursor, so it must be called within a transaction
+func (repo *UserRepo) ForEach(ctx context.Context, fn func(*domain.User) error) error {
+	query := `DECLARE users_cursor NO SCROLL CURSOR FOR
+			  SELECT id, created_at, updated_at, name, email FROM users ORDER BY created_at, id;`
+	if _, err := repo.qx.ExecContext(ctx, query); err != nil {
+		repo.log.ErrorContext(ctx, "could not declare users cursor", sl.Err(err))
 		return err
 	}
+	defer func() {
+		if _, err := repo.qx.ExecContext(ctx, `CLOSE users_cursor;`); err != nil {
+			repo.log.DebugContext(ctx, "could not close users cursor", sl.Err(err))
+		}
+	}()
 
-	if repo.coll != nil {
-		repo.coll.Add(user)
+	fetch := fmt.Sprintf(`FETCH %d FROM users_cursor;`, userCursorFetchSize)
+	for {
+		fetched, err := repo.fetch(ctx, fetch, fn)
+		if err != nil {
+			return err
+		}
+
+		if fetched < userCursorFetchSize {
+			return nil
+		}
 	}
+}
 
-	return nil
+func (repo *UserRepo) fetch(ctx context.Context, query string, fn func(*domain.User) error) (int, error) {
+	rows, err := repo.qx.QueryContext(ctx, query)
+	if err != nil {
+		repo.log.ErrorContext(ctx, "could not fetch from users cursor", sl.Err(err))
+		return 0, err
+	}
+	defer rows.Close()
+
+	var fetched int
+	for rows.Next() {
+		var snap userSnapshot
+		if err = rows.Scan(&snap.ID, &snap.CreatedAt, &snap.UpdatedAt, &snap.Name, &snap.Email); err != nil {
+			return fetched, err
+		}
+
+		fetched++
+		if err = fn(userFromSnapshot(&snap)); err != nil {
+			return fetched, err
+		}
+	}
+
+	return fetched, rows.Err()
 }
 
+// Insert adds the user to be inserted on UnitOfWork.Save
+func (repo *UserRepo) Insert(ctx context.Context, user *domain.User) error {
+	if repo.coll == nil {
+		return repo.insert(ctx, []*domain.User{user})
+	}
+
+	return repo.coll.Add(user)
+}
+
+// Remove marks the user to be deleted on UnitOfWork.Save
 func (repo *UserRepo) Remove(ctx context.Context, user *domain.User) error {
-	query := `DELETE FROM users WHERE id = $1;`
+	if repo.coll == nil {
+		return repo.delete(ctx, []*domain.User{user})
+	}
 
-	_, err := repo.qx.ExecContext(ctx, query, user.ID())
-	if err != nil {
-		return err
+	repo.coll.Remove(user)
+	return nil
+}
+
+func (repo *UserRepo) beforeSave() error {
+	return repo.coll.BeforeSave()
+}
+
+func (repo *UserRepo) flushInserts(ctx context.Context) error {
+	return repo.insert(ctx, repo.coll.Added())
+}
+
+func (repo *UserRepo) flushUpdates(ctx context.Context) error {
+	for _, changes := range repo.coll.Changes() {
+		if err := repo.update(ctx, changes.Entity, changes.Fields); err != nil {
+			return err
+		}
 	}
 
-	if repo.coll != nil {
-		repo.coll.Remove(user)
+	return nil
+}
+
+func (repo *UserRepo) flushDeletes(ctx context.Context) error {
+	return repo.delete(ctx, repo.coll.Deleted())
+}
+
+func (repo *UserRepo) acceptChanges() {
+	repo.coll.AcceptChanges()
+}
+
+// userInsertBatchSize keeps the number of query parameters below the Postgres limit
+const userInsertBatchSize = 1000
+
+func (repo *UserRepo) insert(ctx context.Context, users []*domain.User) error {
+	for len(users) > 0 {
+		batch := users[:min(len(users), userInsertBatchSize)]
+		users = users[len(batch):]
+
+		values := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*5)
+		for i, user := range batch {
+			n := i * 5
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+			args = append(args, user.ID(), user.CreatedAt(), user.UpdatedAt(), user.Name(), user.Email())
+		}
+
+		query := `INSERT INTO users (id, created_at, updated_at, name, email) VALUES ` + strings.Join(values, ", ") + `;`
+		repo.log.DebugContext(ctx, "inserting into users", slog.Int("count", len(batch)))
+
+		if _, err := repo.qx.ExecContext(ctx, query, args...); err != nil {
+			repo.log.ErrorContext(ctx, "could not insert into users", sl.Err(err))
+			return err
+		}
+		repo.log.InfoContext(ctx, "inserted into users", slog.Int("count", len(batch)))
 	}
 
 	return nil
 }
 
-func (repo *UserRepo) update(ctx context.Context, user *domain.User) error {
-	log := repo.log.With(slog.String("user_id", user.ID().String()))
+func (repo *UserRepo) delete(ctx context.Context, users []*domain.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID().String())
+	}
+
+	query := `DELETE FROM users WHERE id = ANY($1::uuid[]);`
+	repo.log.DebugContext(ctx, "deleting from users", slog.Int("count", len(ids)))
+
+	if _, err := repo.qx.ExecContext(ctx, query, ids); err != nil {
+		repo.log.ErrorContext(ctx, "could not delete from users", sl.Err(err))
+		return err
+	}
+	repo.log.InfoContext(ctx, "deleted from users", slog.Int("count", len(ids)))
+
+	return nil
+}
+
+func (repo *UserRepo) update(ctx context.Context, user *domain.User, changes []changetracker.FieldChange) error {
+	columns := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		columns = append(columns, ch.Field)
+	}
+
+	log := repo.log.With(
+		slog.String("user_id", user.ID().String()),
+		slog.Any("changed_columns", columns),
+	)
+
+	set := make([]string, 0, len(changes))
+	args := make([]any, 0, len(changes)+1)
+	for i, ch := range changes {
+		set = append(set, fmt.Sprintf("%s = $%d", ch.Field, i+1))
+		args = append(args, ch.New)
+	}
+	args = append(args, user.ID())
 
-	query := `UPDATE users
-			  SET (created_at, updated_at, name, email) = ($1, $2, $3, $4)
-			  WHERE id = $5;`
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d;`, strings.Join(set, ", "), len(args))
 	log.DebugContext(ctx, "updating in users", slog.String("query", query))
 
-	if _, err := repo.qx.ExecContext(
-		ctx,
-		query,
-		user.CreatedAt(),
-		user.UpdatedAt(),
-		user.Name(),
-		user.Email(),
-		user.ID(),
-	); err != nil {
+	if _, err := repo.qx.ExecContext(ctx, query, args...); err != nil {
 		log.ErrorContext(ctx, "could not update in users", sl.Err(err))
 		return err
 	}
@@ -3,18 +3,95 @@ package kfk
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"sync/atomic"
+	"time"
 )
 
+var tracer = otel.Tracer("github.com/akimsavvin/test_go/internal/presentation/kfk")
+
 var (
-	ErrConsumerStopped = errors.New("consumer has been stopped")
+	ErrConsumerStopped    = errors.New("consumer has been stopped")
+	ErrConsumerNotRunning = errors.New("consumer is not running")
 )
 
 type Consumer interface {
+	// Name identifies the consumer in the logs and health checks
+	Name() string
+
 	Run(ctx context.Context) error
+
+	// Check reports whether the consumer is running
+	Check(ctx context.Context) error
+}
+
+// ConsumerObserver observes the consumed messages, err is nil if the message is handled
+// and lag is the number of messages of the partition left behind the message
+type ConsumerObserver interface {
+	ObserveMessage(consumer string, lag int64, err error)
 }
 
+// ConsumerConfig configures the reader of the consumer, zero MaxBytes defaults to 10MB
+// and StartOffset is kafka.FirstOffset or kafka.LastOffset
 type ConsumerConfig struct {
 	Brokers []string
 	Topic   string
 	GroupID string
+
+	Dialer         *kafka.Dialer
+	MinBytes       int
+	MaxBytes       int
+	MaxWait        time.Duration
+	CommitInterval time.Duration
+	StartOffset    int64
+}
+
+// readerConfig returns the config of the reader of the consumer
+func (cfg ConsumerConfig) readerConfig() kafka.ReaderConfig {
+	maxBytes := cfg.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = 10e6 // 10MB
+	}
+
+	return kafka.ReaderConfig{
+		Brokers:        cfg.Brokers,
+		GroupID:        cfg.GroupID,
+		Topic:          cfg.Topic,
+		Dialer:         cfg.Dialer,
+		MinBytes:       cfg.MinBytes,
+		MaxBytes:       maxBytes,
+		MaxWait:        cfg.MaxWait,
+		CommitInterval: cfg.CommitInterval,
+		StartOffset:    cfg.StartOffset,
+	}
+}
+
+// runState tracks whether the consumer is running and why it has stopped
+type runState struct {
+	running atomic.Bool
+	err     atomic.Pointer[error]
+}
+
+func (s *runState) start() {
+	s.err.Store(nil)
+	s.running.Store(true)
+}
+
+func (s *runState) stop(err error) {
+	s.err.Store(&err)
+	s.running.Store(false)
+}
+
+func (s *runState) Check(context.Context) error {
+	if s.running.Load() {
+		return nil
+	}
+
+	if err := s.err.Load(); err != nil && *err != nil {
+		return fmt.Errorf("%w: %w", ErrConsumerNotRunning, *err)
+	}
+
+	return ErrConsumerNotRunning
 }
@@ -5,9 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/otelkafka"
 	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
+	"strconv"
 	"strings"
 )
 
@@ -17,9 +23,12 @@ type CreateMessagePayload struct {
 }
 
 type CreateUserConsumer struct {
+	runState
+
 	log     *slog.Logger
 	cfg     ConsumerConfig
 	useCase usecase.UserUseCase
+	obs     ConsumerObserver
 }
 
 var _ Consumer = (*CreateUserConsumer)(nil)
@@ -27,7 +36,8 @@ var _ Consumer = (*CreateUserConsumer)(nil)
 func NewCreateUserConsumer(
 	log *slog.Logger,
 	cfg ConsumerConfig,
-	useCase usecase.UserUseCase) *CreateUserConsumer {
+	useCase usecase.UserUseCase,
+	obs ConsumerObserver) *CreateUserConsumer {
 	log = log.With(slog.Group(
 		"consumer",
 		slog.String("brokers", strings.Join(cfg.Brokers, ",")),
@@ -39,22 +49,31 @@ func NewCreateUserConsumer(
 		log:     log,
 		cfg:     cfg,
 		useCase: useCase,
+		obs:     obs,
 	}
 }
 
-func (cons *CreateUserConsumer) Run(ctx context.Context) error {
+func (cons *CreateUserConsumer) Name() string {
+	return cons.cfg.GroupID + "/" + cons.cfg.Topic
+}
+
+func (cons *CreateUserConsumer) Run(ctx context.Context) (err error) {
 	cons.log.InfoContext(ctx, "running consumer")
 
-	read := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  cons.cfg.Brokers,
-		GroupID:  cons.cfg.GroupID,
-		Topic:    cons.cfg.Topic,
-		MaxBytes: 10e6, // 10MB
-	})
+	cons.start()
+	defer func() {
+		cons.stop(err)
+	}()
+
+	read := kafka.NewReader(cons.cfg.readerConfig())
 	defer read.Close()
 
+	// the fetched message is handled and committed even if the context is cancelled meanwhile,
+	// so the consumer stops only between the messages
+	handleCtx := context.WithoutCancel(ctx)
+
 	for {
-		msg, err := read.ReadMessage(ctx)
+		msg, err := read.FetchMessage(ctx)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				cons.log.InfoContext(ctx, "consumer stopped", sl.Err(err))
@@ -65,15 +84,52 @@ func (cons *CreateUserConsumer) Run(ctx context.Context) error {
 			return err
 		}
 
-		var payload CreateMessagePayload
-		if err = json.Unmarshal(msg.Value, &payload); err != nil {
-			cons.log.ErrorContext(ctx, "failed to unmarshal message value", sl.Err(err))
-			continue
+		err = cons.handle(handleCtx, &msg)
+		if cons.obs != nil {
+			cons.obs.ObserveMessage(cons.Name(), msg.HighWaterMark-msg.Offset-1, err)
+		}
+
+		if err = read.CommitMessages(handleCtx, msg); err != nil {
+			cons.log.ErrorContext(ctx, "failed to commit message", sl.Err(err))
+			return err
+		}
+	}
+}
+
+func (cons *CreateUserConsumer) handle(ctx context.Context, msg *kafka.Message) (err error) {
+	ctx = sl.ExtractIDs(otelkafka.Extract(ctx, msg), otelkafka.NewHeaderCarrier(msg))
+	if sl.RequestID(ctx) == "" {
+		ctx = sl.WithRequestID(ctx, uuid.NewString())
+	}
+
+	ctx, span := tracer.Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingKafkaConsumerGroup(cons.cfg.GroupID),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
+		span.End()
+	}()
 
-		_, _ = cons.useCase.Create(ctx, &usecase.CreateUserDTO{
-			Name:  payload.Name,
-			Email: payload.Email,
-		})
+	var payload CreateMessagePayload
+	if err = json.Unmarshal(msg.Value, &payload); err != nil {
+		cons.log.ErrorContext(ctx, "failed to unmarshal message value", sl.Err(err))
+		return err
 	}
+
+	_, err = cons.useCase.Create(ctx, &usecase.CreateUserDTO{
+		Name:  payload.Name,
+		Email: payload.Email,
+	})
+	return err
 }
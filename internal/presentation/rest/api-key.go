@@ -0,0 +1,161 @@
+package rest
+
+import (
+	"errors"
+	"github.com/akimsavvin/test_go/internal/domain"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+type IssueAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=255"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,required,max=64"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// IssuedAPIKeyResponse contains the plain key, it is never shown again
+type IssuedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// optionalTime maps the zero time to nil
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func apiKeyDtoToResponse(dto *usecase.APIKeyDTO) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         dto.ID,
+		CreatedAt:  dto.CreatedAt,
+		Name:       dto.Name,
+		Scopes:     dto.Scopes,
+		ExpiresAt:  optionalTime(dto.ExpiresAt),
+		RevokedAt:  optionalTime(dto.RevokedAt),
+		LastUsedAt: optionalTime(dto.LastUsedAt),
+	}
+}
+
+type APIKeyController struct {
+	rl      *RateLimiter
+	useCase usecase.APIKeyUseCase
+}
+
+func NewAPIKeyController(rl *RateLimiter, useCase usecase.APIKeyUseCase) *APIKeyController {
+	return &APIKeyController{
+		rl:      rl,
+		useCase: useCase,
+	}
+}
+
+func (contr *APIKeyController) Init(root fiber.Router) {
+	isAdmin := Authorize(HasRole(RoleAdmin))
+
+	g := root.Group("/api-keys")
+	g.Post("/", contr.issue, isAdmin, contr.rl.For(http.MethodPost, "/api-keys/"))
+	g.Delete("/:id", contr.revoke, isAdmin, contr.rl.For(http.MethodDelete, "/api-keys/:id"))
+}
+
+func (contr *APIKeyController) Operations() []Operation {
+	tags := []string{"api keys"}
+
+	return []Operation{
+		{
+			Method:      http.MethodPost,
+			Path:        "/api-keys/",
+			Summary:     "Issue an API key for a machine client, the key is returned only once",
+			Tags:        tags,
+			RequestBody: &RequestBody{JSONContent(IssueAPIKeyRequest{})},
+			Responses: map[int]Response{
+				http.StatusCreated:             {"issued API key", JSONContent(IssuedAPIKeyResponse{})},
+				http.StatusBadRequest:          {"invalid request", nil},
+				http.StatusUnprocessableEntity: {"invalid API key", nil},
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/api-keys/:id",
+			Summary: "Revoke the API key",
+			Tags:    tags,
+			Params: []Parameter{{
+				Name:        "id",
+				In:          "path",
+				Description: "API key identifier",
+				Schema:      uuid.UUID{},
+			}},
+			Responses: map[int]Response{
+				http.StatusNoContent:  {"API key revoked", nil},
+				http.StatusBadRequest: {"invalid identifier", nil},
+				http.StatusNotFound:   {"API key not found", nil},
+			},
+		},
+	}
+}
+
+func (contr *APIKeyController) issue(fCtx fiber.Ctx) error {
+	var req IssueAPIKeyRequest
+	if err := bindBody(fCtx, &req); err != nil {
+		return err
+	}
+
+	dto := &usecase.IssueAPIKeyDTO{
+		Name:   req.Name,
+		Scopes: req.Scopes,
+	}
+	if req.ExpiresAt != nil {
+		dto.ExpiresAt = *req.ExpiresAt
+	}
+
+	issued, err := contr.useCase.Issue(fCtx.Context(), dto)
+	if err != nil {
+		return apiKeyError(err)
+	}
+
+	return fCtx.Status(fiber.StatusCreated).JSON(IssuedAPIKeyResponse{
+		APIKeyResponse: apiKeyDtoToResponse(&issued.APIKeyDTO),
+		Key:            issued.Key,
+	})
+}
+
+func (contr *APIKeyController) revoke(fCtx fiber.Ctx) error {
+	id, err := uuid.Parse(fCtx.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, "id is not a valid uuid")
+	}
+
+	if err = contr.useCase.Revoke(fCtx.Context(), id); err != nil {
+		return apiKeyError(err)
+	}
+
+	return fCtx.Status(fiber.StatusNoContent).Send(nil)
+}
+
+func apiKeyError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrAPIKeyNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrInvalidAPIKeyName),
+		errors.Is(err, domain.ErrInvalidAPIKeyScopes),
+		errors.Is(err, domain.ErrInvalidAPIKeyExpiry):
+		return fiber.NewError(http.StatusUnprocessableEntity, err.Error())
+	default:
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+}
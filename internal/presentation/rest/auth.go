@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/jwtauth"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/gofiber/fiber/v3"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	RoleAdmin = "admin"
+
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// Principal is the authenticated caller
+type Principal struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+}
+
+type principalCtxKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying the principal
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the request
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(*Principal)
+	return p, ok
+}
+
+// TokenVerifier verifies a bearer token
+type TokenVerifier interface {
+	Verify(token string) (*jwtauth.Claims, error)
+}
+
+// APIKeyAuthenticator authenticates a machine client by its API key
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*usecase.APIKeyDTO, error)
+}
+
+const (
+	schemeBearer = "Bearer"
+	schemeAPIKey = "ApiKey"
+)
+
+// apiKeySubjectPrefix keeps the API key subjects apart from the user ones
+const apiKeySubjectPrefix = "api_key:"
+
+// Authenticate verifies the bearer token or the API key and puts the principal on the request context
+func Authenticate(verifier TokenVerifier, apiKeys APIKeyAuthenticator) fiber.Handler {
+	return func(fCtx fiber.Ctx) error {
+		scheme, credentials, _ := strings.Cut(fCtx.Get(fiber.HeaderAuthorization), " ")
+
+		var (
+			p   *Principal
+			err error
+		)
+		switch {
+		case strings.EqualFold(scheme, schemeBearer) && credentials != "":
+			p, err = authenticateBearer(fCtx, verifier, credentials)
+		case strings.EqualFold(scheme, schemeAPIKey) && credentials != "":
+			p, err = authenticateAPIKey(fCtx, apiKeys, credentials)
+		default:
+			fCtx.Set(fiber.HeaderWWWAuthenticate, schemeBearer+", "+schemeAPIKey)
+			return fiber.NewError(http.StatusUnauthorized, "bearer token or api key is required")
+		}
+		if err != nil {
+			return err
+		}
+
+		ctx := sl.WithUserID(fCtx.Context(), p.Subject)
+		fCtx.SetContext(ContextWithPrincipal(ctx, p))
+		return fCtx.Next()
+	}
+}
+
+func authenticateBearer(fCtx fiber.Ctx, verifier TokenVerifier, token string) (*Principal, error) {
+	claims, err := verifier.Verify(token)
+	if err != nil {
+		fCtx.Set(fiber.HeaderWWWAuthenticate, schemeBearer+` error="invalid_token"`)
+		return nil, fiber.NewError(http.StatusUnauthorized, "invalid bearer token")
+	}
+
+	return &Principal{
+		Subject: claims.Subject,
+		Roles:   claims.Roles,
+		Scopes:  claims.Scopes(),
+	}, nil
+}
+
+func authenticateAPIKey(fCtx fiber.Ctx, apiKeys APIKeyAuthenticator, key string) (*Principal, error) {
+	if apiKeys == nil {
+		fCtx.Set(fiber.HeaderWWWAuthenticate, schemeBearer)
+		return nil, fiber.NewError(http.StatusUnauthorized, "api keys are not accepted")
+	}
+
+	dto, err := apiKeys.Authenticate(fCtx.Context(), key)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidAPIKey) {
+			fCtx.Set(fiber.HeaderWWWAuthenticate, schemeAPIKey)
+			return nil, fiber.NewError(http.StatusUnauthorized, "invalid api key")
+		}
+
+		return nil, err
+	}
+
+	return &Principal{
+		Subject: apiKeySubjectPrefix + dto.ID.String(),
+		Scopes:  dto.Scopes,
+	}, nil
+}
+
+// Policy decides whether the principal may access the route
+type Policy func(fCtx fiber.Ctx, p *Principal) bool
+
+// HasRole allows the principals having any of the roles
+func HasRole(roles ...string) Policy {
+	return func(_ fiber.Ctx, p *Principal) bool {
+		return slices.ContainsFunc(p.Roles, func(role string) bool {
+			return slices.Contains(roles, role)
+		})
+	}
+}
+
+// HasScope allows the principals granted any of the scopes
+func HasScope(scopes ...string) Policy {
+	return func(_ fiber.Ctx, p *Principal) bool {
+		return slices.ContainsFunc(p.Scopes, func(scope string) bool {
+			return slices.Contains(scopes, scope)
+		})
+	}
+}
+
+// IsSelf allows the principal whose subject equals the route parameter
+func IsSelf(param string) Policy {
+	return func(fCtx fiber.Ctx, p *Principal) bool {
+		return p.Subject != "" && strings.EqualFold(p.Subject, fCtx.Params(param))
+	}
+}
+
+// Authorize allows the request if the principal satisfies any of the policies
+func Authorize(policies ...Policy) fiber.Handler {
+	return func(fCtx fiber.Ctx) error {
+		p, ok := PrincipalFromContext(fCtx.Context())
+		if !ok {
+			return fiber.NewError(http.StatusUnauthorized, "authentication is required")
+		}
+
+		for _, policy := range policies {
+			if policy(fCtx, p) {
+				return fCtx.Next()
+			}
+		}
+
+		return fiber.NewError(http.StatusForbidden, "access is denied")
+	}
+}
@@ -0,0 +1,136 @@
+package rest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/akimsavvin/test_go/internal/presentation/rest"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/jwtauth"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// tokenVerifier accepts the tokens of its claims
+type tokenVerifier map[string]*jwtauth.Claims
+
+func (v tokenVerifier) Verify(token string) (*jwtauth.Claims, error) {
+	c, ok := v[token]
+	if !ok {
+		return nil, jwtauth.ErrInvalidToken
+	}
+
+	return c, nil
+}
+
+// apiKeyAuthenticator accepts the keys of its API keys
+type apiKeyAuthenticator map[string]*usecase.APIKeyDTO
+
+func (a apiKeyAuthenticator) Authenticate(_ context.Context, key string) (*usecase.APIKeyDTO, error) {
+	dto, ok := a[key]
+	if !ok {
+		return nil, usecase.ErrInvalidAPIKey
+	}
+
+	return dto, nil
+}
+
+func TestAuthorize(t *testing.T) {
+	const self = "0b7f6c2e-4f3a-4d4b-9a57-3f0d6f1d2a11"
+
+	verifier := tokenVerifier{
+		"self":   {RegisteredClaims: jwt.RegisteredClaims{Subject: self}},
+		"admin":  {RegisteredClaims: jwt.RegisteredClaims{Subject: "admin"}, Roles: []string{rest.RoleAdmin}},
+		"reader": {RegisteredClaims: jwt.RegisteredClaims{Subject: "reader"}, Scope: "profile " + rest.ScopeUsersRead},
+		"other":  {RegisteredClaims: jwt.RegisteredClaims{Subject: "other"}, Roles: []string{"support"}},
+		"empty":  {},
+	}
+	apiKeys := apiKeyAuthenticator{
+		"reader-key": {ID: uuid.New(), Scopes: []string{rest.ScopeUsersRead}},
+		"writer-key": {ID: uuid.New(), Scopes: []string{rest.ScopeUsersWrite}},
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: rest.ErrorHandler})
+	g := app.Group("/", rest.Authenticate(verifier, apiKeys))
+	ok := func(fCtx fiber.Ctx) error {
+		return fCtx.SendStatus(http.StatusNoContent)
+	}
+	g.Get("/users/:id", ok, rest.Authorize(rest.IsSelf("id"), rest.HasRole(rest.RoleAdmin), rest.HasScope(rest.ScopeUsersRead)))
+	g.Get("/admin", ok, rest.Authorize(rest.HasRole(rest.RoleAdmin)))
+	g.Get("/empty/:id?", ok, rest.Authorize(rest.IsSelf("id")))
+
+	tests := []struct {
+		name   string
+		path   string
+		auth   string
+		status int
+	}{
+		{"no credentials", "/admin", "", http.StatusUnauthorized},
+		{"unknown scheme", "/admin", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"invalid token", "/admin", "Bearer forged", http.StatusUnauthorized},
+		{"invalid api key", "/admin", "ApiKey forged", http.StatusUnauthorized},
+		{"admin role", "/admin", "Bearer admin", http.StatusNoContent},
+		{"other role", "/admin", "Bearer other", http.StatusForbidden},
+		{"scope is not a role", "/admin", "Bearer reader", http.StatusForbidden},
+		{"self", "/users/" + self, "Bearer self", http.StatusNoContent},
+		{"self case insensitive", "/users/0B7F6C2E-4F3A-4D4B-9A57-3F0D6F1D2A11", "bearer self", http.StatusNoContent},
+		{"not self", "/users/" + uuid.NewString(), "Bearer self", http.StatusForbidden},
+		{"admin of another user", "/users/" + uuid.NewString(), "Bearer admin", http.StatusNoContent},
+		{"read scope", "/users/" + uuid.NewString(), "Bearer reader", http.StatusNoContent},
+		{"api key read scope", "/users/" + uuid.NewString(), "ApiKey reader-key", http.StatusNoContent},
+		{"api key write scope", "/users/" + uuid.NewString(), "ApiKey writer-key", http.StatusForbidden},
+		{"api key is never an admin", "/admin", "ApiKey reader-key", http.StatusForbidden},
+		{"empty subject is not self", "/empty/", "Bearer empty", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.auth)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKeyFailure(t *testing.T) {
+	failing := apiKeyAuthenticatorFunc(func(context.Context, string) (*usecase.APIKeyDTO, error) {
+		return nil, errors.New("storage is down")
+	})
+
+	app := fiber.New(fiber.Config{ErrorHandler: rest.ErrorHandler})
+	app.Get("/", func(fCtx fiber.Ctx) error {
+		return fCtx.SendStatus(http.StatusNoContent)
+	}, rest.Authenticate(tokenVerifier{}, failing))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "ApiKey key")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a storage failure is not reported as invalid credentials
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+}
+
+type apiKeyAuthenticatorFunc func(ctx context.Context, key string) (*usecase.APIKeyDTO, error)
+
+func (f apiKeyAuthenticatorFunc) Authenticate(ctx context.Context, key string) (*usecase.APIKeyDTO, error) {
+	return f(ctx, key)
+}
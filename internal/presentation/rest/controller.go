@@ -6,4 +6,7 @@ import (
 
 type Controller interface {
 	Init(root fiber.Router)
+
+	// Operations documents the routes registered by Init
+	Operations() []Operation
 }
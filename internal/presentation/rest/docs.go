@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/static"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: %q,
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};`
+
+// InitDocs serves the OpenAPI document at /openapi.json and the bundled Swagger UI at /docs,
+// rootPath is the path root is mounted at
+func InitDocs(root fiber.Router, rootPath string, doc *OpenAPIDocument) {
+	specPath := "/openapi.json"
+	initializer := fmt.Sprintf(swaggerInitializer, rootPath+specPath)
+
+	root.Get(specPath, func(fCtx fiber.Ctx) error {
+		return fCtx.Status(fiber.StatusOK).JSON(doc)
+	})
+
+	root.Get("/docs/swagger-initializer.js", func(fCtx fiber.Ctx) error {
+		fCtx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJavaScriptCharsetUTF8)
+		return fCtx.Status(fiber.StatusOK).SendString(initializer)
+	})
+
+	root.Get("/docs*", static.New("", static.Config{
+		FS: swaggerFiles.FS,
+	}))
+}
@@ -0,0 +1,71 @@
+package rest
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v3"
+	"net/http"
+	"strings"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why a single request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when the request fields are invalid
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (err *ValidationError) Error() string {
+	msgs := make([]string, 0, len(err.Fields))
+	for _, f := range err.Fields {
+		msgs = append(msgs, f.Field+" "+f.Message)
+	}
+
+	return "invalid request: " + strings.Join(msgs, "; ")
+}
+
+// ErrorHandler writes every error returned by the handlers as an ErrorResponse
+func ErrorHandler(fCtx fiber.Ctx, err error) error {
+	var vErr *ValidationError
+	if errors.As(err, &vErr) {
+		return fCtx.Status(http.StatusBadRequest).JSON(ErrorResponse{
+			Error:  "invalid request",
+			Fields: vErr.Fields,
+		})
+	}
+
+	code, msg := http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+
+	var fErr *fiber.Error
+	if errors.As(err, &fErr) {
+		code, msg = fErr.Code, fErr.Message
+	}
+
+	return fCtx.Status(code).JSON(ErrorResponse{
+		Error: msg,
+	})
+}
+
+// errorStatus returns the status ErrorHandler responds to the error with
+func errorStatus(err error) int {
+	var vErr *ValidationError
+	if errors.As(err, &vErr) {
+		return http.StatusBadRequest
+	}
+
+	var fErr *fiber.Error
+	if errors.As(err, &fErr) {
+		return fErr.Code
+	}
+
+	return http.StatusInternalServerError
+}
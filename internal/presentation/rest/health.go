@@ -0,0 +1,31 @@
+package rest
+
+import (
+	"github.com/akimsavvin/test_go/pkg/health"
+	"github.com/gofiber/fiber/v3"
+)
+
+// InitHealth serves the liveness probe at /healthz and the readiness probe at /readyz,
+// they answer 200 or 503 with the overall status and with every check result if the verbose query is set
+func InitHealth(root fiber.Router, liveness, readiness *health.Registry) {
+	root.Get("/healthz", healthHandler(liveness))
+	root.Get("/readyz", healthHandler(readiness))
+}
+
+func healthHandler(registry *health.Registry) fiber.Handler {
+	return func(fCtx fiber.Ctx) error {
+		report := registry.Check(fCtx.Context())
+
+		status := fiber.StatusOK
+		if report.Status != health.StatusUp {
+			status = fiber.StatusServiceUnavailable
+		}
+
+		fCtx.Set(fiber.HeaderCacheControl, "no-store")
+		if !fCtx.Request().URI().QueryArgs().Has("verbose") {
+			return fCtx.Status(status).JSON(fiber.Map{"status": report.Status})
+		}
+
+		return fCtx.Status(status).JSON(report)
+	}
+}
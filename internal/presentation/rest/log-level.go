@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"log/slog"
+	"net/http"
+)
+
+// LogLevels changes the logger levels at runtime
+type LogLevels interface {
+	Default() slog.Level
+	SetDefault(level slog.Level)
+	Modules() map[string]slog.Level
+	SetModule(module string, level slog.Level)
+	ResetModule(module string)
+}
+
+type SetLogLevelRequest struct {
+	Level string `json:"level" validate:"required"`
+}
+
+type LogLevelsResponse struct {
+	Default string            `json:"default"`
+	Modules map[string]string `json:"modules"`
+}
+
+type LogLevelController struct {
+	levels LogLevels
+}
+
+func NewLogLevelController(levels LogLevels) *LogLevelController {
+	return &LogLevelController{
+		levels: levels,
+	}
+}
+
+func (contr *LogLevelController) Init(root fiber.Router) {
+	isAdmin := Authorize(HasRole(RoleAdmin))
+
+	g := root.Group("/admin/log-levels")
+	g.Get("/", contr.get, isAdmin)
+	g.Put("/", contr.setDefault, isAdmin)
+	g.Put("/:module", contr.setModule, isAdmin)
+	g.Delete("/:module", contr.resetModule, isAdmin)
+}
+
+func (contr *LogLevelController) Operations() []Operation {
+	tags := []string{"admin"}
+	moduleParam := Parameter{
+		Name:        "module",
+		In:          "path",
+		Description: "operation or logger group",
+		Schema:      "",
+	}
+	levelsResponse := Response{"current log levels", JSONContent(LogLevelsResponse{})}
+
+	return []Operation{
+		{
+			Method:  http.MethodGet,
+			Path:    "/admin/log-levels/",
+			Summary: "Get the default and per-module log levels",
+			Tags:    tags,
+			Responses: map[int]Response{
+				http.StatusOK: levelsResponse,
+			},
+		},
+		{
+			Method:      http.MethodPut,
+			Path:        "/admin/log-levels/",
+			Summary:     "Set the default log level",
+			Tags:        tags,
+			RequestBody: &RequestBody{JSONContent(SetLogLevelRequest{})},
+			Responses: map[int]Response{
+				http.StatusOK:         levelsResponse,
+				http.StatusBadRequest: {"invalid level", nil},
+			},
+		},
+		{
+			Method:      http.MethodPut,
+			Path:        "/admin/log-levels/:module",
+			Summary:     "Override the log level of the module",
+			Tags:        tags,
+			Params:      []Parameter{moduleParam},
+			RequestBody: &RequestBody{JSONContent(SetLogLevelRequest{})},
+			Responses: map[int]Response{
+				http.StatusOK:         levelsResponse,
+				http.StatusBadRequest: {"invalid level", nil},
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/admin/log-levels/:module",
+			Summary: "Remove the log level override of the module",
+			Tags:    tags,
+			Params:  []Parameter{moduleParam},
+			Responses: map[int]Response{
+				http.StatusOK: levelsResponse,
+			},
+		},
+	}
+}
+
+func (contr *LogLevelController) get(fCtx fiber.Ctx) error {
+	return fCtx.Status(fiber.StatusOK).JSON(contr.response())
+}
+
+func (contr *LogLevelController) setDefault(fCtx fiber.Ctx) error {
+	level, err := bindLevel(fCtx)
+	if err != nil {
+		return err
+	}
+
+	contr.levels.SetDefault(level)
+	return fCtx.Status(fiber.StatusOK).JSON(contr.response())
+}
+
+func (contr *LogLevelController) setModule(fCtx fiber.Ctx) error {
+	level, err := bindLevel(fCtx)
+	if err != nil {
+		return err
+	}
+
+	contr.levels.SetModule(fCtx.Params("module"), level)
+	return fCtx.Status(fiber.StatusOK).JSON(contr.response())
+}
+
+func (contr *LogLevelController) resetModule(fCtx fiber.Ctx) error {
+	contr.levels.ResetModule(fCtx.Params("module"))
+	return fCtx.Status(fiber.StatusOK).JSON(contr.response())
+}
+
+func bindLevel(fCtx fiber.Ctx) (slog.Level, error) {
+	var req SetLogLevelRequest
+	if err := bindBody(fCtx, &req); err != nil {
+		return 0, err
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		return 0, fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	return level, nil
+}
+
+func (contr *LogLevelController) response() LogLevelsResponse {
+	modules := contr.levels.Modules()
+
+	res := LogLevelsResponse{
+		Default: contr.levels.Default().String(),
+		Modules: make(map[string]string, len(modules)),
+	}
+	for module, level := range modules {
+		res.Modules[module] = level.String()
+	}
+
+	return res
+}
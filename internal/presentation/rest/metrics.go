@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"time"
+)
+
+// unmatchedRoute labels the requests not matching any route, so the unknown paths do not blow up the label values
+const unmatchedRoute = "unmatched"
+
+// HTTPObserver observes the handled requests, route is the registered route path
+type HTTPObserver interface {
+	ObserveHTTPRequest(method, route string, status int, d time.Duration)
+}
+
+// Instrument reports every request to the observer, it must be used by the application before the routes
+func Instrument(obs HTTPObserver) fiber.Handler {
+	return func(fCtx fiber.Ctx) error {
+		start := time.Now()
+		self := fCtx.Route()
+
+		err := fCtx.Next()
+
+		status := fCtx.Response().StatusCode()
+		if err != nil {
+			status = errorStatus(err)
+		}
+
+		route := unmatchedRoute
+		if matched := fCtx.Route(); matched != self {
+			route = matched.Path
+		}
+
+		obs.ObserveHTTPRequest(fCtx.Method(), route, status, time.Since(start))
+		return err
+	}
+}
@@ -0,0 +1,423 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const openAPIVersion = "3.1.0"
+
+var (
+	ErrOpenAPIDrift = errors.New("routes and OpenAPI document drifted apart")
+)
+
+// Operation documents a single route, Path is the fiber path relative to the controller root
+type Operation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Tags        []string
+	Params      []Parameter
+	RequestBody *RequestBody
+	Responses   map[int]Response
+}
+
+// Parameter documents a path, query or header parameter, Schema is a sample value of its type
+type Parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      any
+}
+
+// Content maps the content types to sample values of the body types
+type Content map[string]any
+
+// JSONContent returns the Content of the JSON body
+func JSONContent(body any) Content {
+	return Content{fiber.MIMEApplicationJSON: body}
+}
+
+// RequestBody documents the request body
+type RequestBody struct {
+	Content Content
+}
+
+// Response documents a response, nil Content for no body
+type Response struct {
+	Description string
+	Content     Content
+}
+
+type OpenAPIDocument struct {
+	OpenAPI    string                             `json:"openapi"`
+	Info       OpenAPIInfo                        `json:"info"`
+	Paths      map[string]map[string]*oaOperation `json:"paths"`
+	Components oaComponents                       `json:"components"`
+	Security   []map[string][]string              `json:"security"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type oaComponents struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+type oaOperation struct {
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	OperationID string                 `json:"operationId"`
+	Parameters  []oaParameter          `json:"parameters,omitempty"`
+	RequestBody *oaRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*oaResponse `json:"responses"`
+}
+
+type oaParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type oaRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]*oaMediaType `json:"content"`
+}
+
+type oaResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]*oaMediaType `json:"content,omitempty"`
+}
+
+type oaMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON Schema of a DTO
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+var (
+	fiberParamRegexp   = regexp.MustCompile(`/:(\w+)`)
+	openAPIParamRegexp = regexp.MustCompile(`\{(\w+)}`)
+)
+
+// openAPIPath converts the fiber path to the OpenAPI one
+func openAPIPath(path string) string {
+	if len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+
+	path = fiberParamRegexp.ReplaceAllString(path, "/{$1}")
+	return strings.ReplaceAll(path, `\:`, ":")
+}
+
+// BuildOpenAPI builds the OpenAPI document of the controllers mounted at basePath
+func BuildOpenAPI(info OpenAPIInfo, basePath string, conts []Controller) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]map[string]*oaOperation),
+		Components: oaComponents{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]*securityScheme{
+				"bearerAuth": {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+				"apiKeyAuth": {
+					Type:        "apiKey",
+					Description: "API key of a machine client in the form `ApiKey <key>`",
+					In:          "header",
+					Name:        fiber.HeaderAuthorization,
+				},
+			},
+		},
+		Security: []map[string][]string{
+			{"bearerAuth": {}},
+			{"apiKeyAuth": {}},
+		},
+	}
+
+	for _, cont := range conts {
+		for _, op := range cont.Operations() {
+			path := openAPIPath(basePath + op.Path)
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]*oaOperation)
+			}
+
+			doc.Paths[path][strings.ToLower(op.Method)] = doc.operation(path, op)
+		}
+	}
+
+	return doc
+}
+
+func (doc *OpenAPIDocument) operation(path string, op Operation) *oaOperation {
+	res := &oaOperation{
+		Summary:     op.Summary,
+		Tags:        op.Tags,
+		OperationID: operationID(op.Method, path),
+		Responses:   make(map[string]*oaResponse, len(op.Responses)),
+	}
+
+	for _, match := range openAPIParamRegexp.FindAllStringSubmatch(path, -1) {
+		name := match[1]
+		if slices.ContainsFunc(op.Params, func(p Parameter) bool { return p.In == "path" && p.Name == name }) {
+			continue
+		}
+
+		res.Parameters = append(res.Parameters, oaParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+
+	for _, p := range op.Params {
+		res.Parameters = append(res.Parameters, oaParameter{
+			Name:        p.Name,
+			In:          p.In,
+			Description: p.Description,
+			Required:    p.Required || p.In == "path",
+			Schema:      doc.schemaOf(reflect.TypeOf(p.Schema)),
+		})
+	}
+
+	if op.RequestBody != nil {
+		res.RequestBody = &oaRequestBody{
+			Required: true,
+			Content:  doc.content(op.RequestBody.Content),
+		}
+	}
+
+	for code, resp := range op.Responses {
+		content := resp.Content
+		if content == nil && code >= http.StatusBadRequest {
+			content = JSONContent(ErrorResponse{})
+		}
+
+		res.Responses[fmt.Sprint(code)] = &oaResponse{
+			Description: resp.Description,
+			Content:     doc.content(content),
+		}
+	}
+
+	return res
+}
+
+func (doc *OpenAPIDocument) content(content Content) map[string]*oaMediaType {
+	if len(content) == 0 {
+		return nil
+	}
+
+	res := make(map[string]*oaMediaType, len(content))
+	for ct, body := range content {
+		res[ct] = &oaMediaType{doc.schemaOf(reflect.TypeOf(body))}
+	}
+
+	return res
+}
+
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == ':'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	return id
+}
+
+var (
+	uuidType = reflect.TypeFor[uuid.UUID]()
+	timeType = reflect.TypeFor[time.Time]()
+)
+
+// schemaOf returns the schema of the type, named structs are registered as components
+func (doc *OpenAPIDocument) schemaOf(typ reflect.Type) *Schema {
+	if typ == nil {
+		return &Schema{}
+	}
+
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ {
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: doc.schemaOf(typ.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: doc.schemaOf(typ.Elem())}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return doc.structSchema(typ)
+		}
+
+		if _, ok := doc.Components.Schemas[typ.Name()]; !ok {
+			// registered before building to stop the recursion on self-referencing types
+			doc.Components.Schemas[typ.Name()] = &Schema{}
+			*doc.Components.Schemas[typ.Name()] = *doc.structSchema(typ)
+		}
+
+		return &Schema{Ref: "#/components/schemas/" + typ.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+func (doc *OpenAPIDocument) structSchema(typ reflect.Type) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := doc.schemaOf(f.Type)
+		schema.Properties[name] = prop
+
+		// the validation rules decide for the requests, the presence in JSON for the responses
+		required := f.Type.Kind() != reflect.Pointer && !strings.Contains(opts, "omitempty")
+		if tag, ok := f.Tag.Lookup("validate"); ok {
+			required = applyValidateTag(prop, tag)
+		}
+
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// applyValidateTag documents the "validate" tag rules in the schema and reports if the field is required
+func applyValidateTag(schema *Schema, tag string) (required bool) {
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "dive" {
+			break
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		n, err := strconv.Atoi(param)
+
+		switch {
+		case name == "required":
+			required = true
+		case schema.Ref != "":
+			// the rules of a referenced schema belong to its own fields
+		case name == "email":
+			schema.Format = "email"
+		case name == "oneof":
+			schema.Enum = strings.Fields(param)
+		case name == "max" && err == nil && schema.Type == "array":
+			schema.MaxItems = &n
+		case name == "max" && err == nil && schema.Type == "string":
+			schema.MaxLength = &n
+		case name == "min" && err == nil && schema.Type == "array":
+			schema.MinItems = &n
+		}
+	}
+
+	return required
+}
+
+// VerifyOpenAPI checks every route under basePath is documented and every documented operation has a route
+func VerifyOpenAPI(doc *OpenAPIDocument, basePath string, routes []fiber.Route) error {
+	var errs []error
+
+	routed := make(map[string]bool)
+	for _, route := range routes {
+		if route.Method == http.MethodHead || !strings.HasPrefix(route.Path, basePath+"/") {
+			continue
+		}
+
+		path := openAPIPath(route.Path)
+		key := route.Method + " " + path
+		if routed[key] {
+			continue
+		}
+		routed[key] = true
+
+		if _, ok := doc.Paths[path][strings.ToLower(route.Method)]; !ok {
+			errs = append(errs, fmt.Errorf("%w: %s is not documented", ErrOpenAPIDrift, key))
+		}
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			key := strings.ToUpper(method) + " " + path
+			if !routed[key] {
+				errs = append(errs, fmt.Errorf("%w: %s is documented but not routed", ErrOpenAPIDrift, key))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package rest_test
+
+import (
+	"github.com/akimsavvin/test_go/internal/presentation/rest"
+	"github.com/gofiber/fiber/v3"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+const apiBasePath = "/api/v1"
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	conts := []rest.Controller{
+		rest.NewAPIKeyController(nil, nil),
+		rest.NewLogLevelController(nil),
+		rest.NewUserController(slog.New(slog.NewTextHandler(io.Discard, nil)), rest.UserControllerConfig{}, nil),
+	}
+
+	app := fiber.New()
+	v1 := app.Group(apiBasePath)
+	for _, cont := range conts {
+		cont.Init(v1)
+	}
+
+	doc := rest.BuildOpenAPI(rest.OpenAPIInfo{Title: "Lure API", Version: "v1"}, apiBasePath, conts)
+	if err := rest.VerifyOpenAPI(doc, apiBasePath, app.GetRoutes(true)); err != nil {
+		t.Fatalf("OpenAPI document does not match the routes:\n%v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/akimsavvin/test_go/pkg/ratelimit"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/gofiber/fiber/v3"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitKey identifies the client a rate limit applies to
+type RateLimitKey string
+
+const (
+	// RateLimitByIP limits every client IP
+	RateLimitByIP RateLimitKey = "ip"
+
+	// RateLimitByAPIKey limits every API key, the other requests are limited by IP
+	RateLimitByAPIKey RateLimitKey = "api_key"
+
+	// RateLimitByPrincipal limits every authenticated user or API key, anonymous requests are limited by IP
+	RateLimitByPrincipal RateLimitKey = "principal"
+)
+
+// RouteRateLimit is the rate limit of a route
+type RouteRateLimit struct {
+	ratelimit.Limit
+	Key RateLimitKey
+}
+
+// RateLimiter creates the rate limiting middlewares of the routes
+type RateLimiter struct {
+	log     *slog.Logger
+	limiter ratelimit.Limiter
+	limits  atomic.Pointer[rateLimits]
+
+	mu     sync.RWMutex
+	routes []limitedRoute
+}
+
+// limitedRoute is a route passed to For, matched by LimitByIP before the routing
+type limitedRoute struct {
+	method  string
+	pattern string
+	name    string
+}
+
+// ipLimitedCtxKey marks the request limited by IP before the authentication
+type ipLimitedCtxKey struct{}
+
+// rateLimits are the limits of the routes replaced at once by SetLimits
+type rateLimits struct {
+	routes map[string]RouteRateLimit
+	def    *RouteRateLimit
+}
+
+// NewRateLimiter creates a RateLimiter applying the limits of the routes named as "METHOD /path"
+// with the OpenAPI path relative to the API root, e.g. "POST /users" or "GET /users/{id}",
+// and the default limit, if any, to the rest of them
+func NewRateLimiter(
+	log *slog.Logger,
+	limiter ratelimit.Limiter,
+	routes map[string]RouteRateLimit,
+	def *RouteRateLimit) (*RateLimiter, error) {
+	rl := &RateLimiter{
+		log:     log,
+		limiter: limiter,
+	}
+
+	if err := rl.SetLimits(routes, def); err != nil {
+		return nil, err
+	}
+
+	return rl, nil
+}
+
+// SetLimits replaces the limits of the routes and the default one, the requests in flight keep the previous limits
+func (rl *RateLimiter) SetLimits(routes map[string]RouteRateLimit, def *RouteRateLimit) error {
+	for route, limit := range routes {
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("route %s: %w", route, err)
+		}
+	}
+
+	if def != nil {
+		if err := def.Validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+
+	rl.limits.Store(&rateLimits{
+		routes: routes,
+		def:    def,
+	})
+	return nil
+}
+
+// limit returns the limit of the route or the default one
+func (rl *RateLimiter) limit(route string) (RouteRateLimit, bool) {
+	limits := rl.limits.Load()
+	if limit, ok := limits.routes[route]; ok {
+		return limit, true
+	}
+
+	if limits.def == nil {
+		return RouteRateLimit{}, false
+	}
+
+	return *limits.def, true
+}
+
+// LimitByIP returns the middleware applying the IP keyed limits of the routes under basePath,
+// it must run before Authenticate, so the requests with invalid credentials are limited too.
+// The requests matching no route are limited by the default limit if it is IP keyed.
+// Nil RateLimiter does not limit anything.
+func (rl *RateLimiter) LimitByIP(basePath string) fiber.Handler {
+	if rl == nil {
+		return passThrough
+	}
+
+	return func(fCtx fiber.Ctx) error {
+		route := rl.match(fCtx.Method(), strings.TrimPrefix(fCtx.Path(), basePath))
+
+		limit, ok := rl.limit(route)
+		if !ok || limit.Key != RateLimitByIP {
+			return fCtx.Next()
+		}
+
+		fCtx.Locals(ipLimitedCtxKey{}, true)
+		return rl.allow(fCtx, route, limit)
+	}
+}
+
+// match returns the name of the first route passed to For matching the request path,
+// the unmatched requests share the "*" route
+func (rl *RateLimiter) match(method, path string) string {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	for _, route := range rl.routes {
+		if route.method == method && fiber.RoutePatternMatch(path, route.pattern) {
+			return route.name
+		}
+	}
+
+	return "*"
+}
+
+// For returns the middleware limiting the route by the principal or the API key, it must run after Authenticate.
+// The IP keyed limit is applied by LimitByIP, if it has not run, by this middleware.
+// Nil RateLimiter does not limit anything.
+func (rl *RateLimiter) For(method, path string) fiber.Handler {
+	if rl == nil {
+		return passThrough
+	}
+
+	route := method + " " + openAPIPath(path)
+
+	rl.mu.Lock()
+	rl.routes = append(rl.routes, limitedRoute{method, path, route})
+	rl.mu.Unlock()
+
+	return func(fCtx fiber.Ctx) error {
+		// the limit is resolved on every request, so it follows SetLimits
+		limit, ok := rl.limit(route)
+		if !ok {
+			return fCtx.Next()
+		}
+
+		if limited, _ := fCtx.Locals(ipLimitedCtxKey{}).(bool); limited && limit.Key == RateLimitByIP {
+			return fCtx.Next()
+		}
+
+		return rl.allow(fCtx, route, limit)
+	}
+}
+
+// allow counts the request against the limit of the route and rejects it if the limit is exceeded
+func (rl *RateLimiter) allow(fCtx fiber.Ctx, route string, limit RouteRateLimit) error {
+	key := route + ":" + rateLimitSubject(fCtx, limit.Key)
+
+	res, err := rl.limiter.Allow(fCtx.Context(), key, limit.Limit)
+	if err != nil {
+		// the requests are not rejected because of the limiter failure
+		rl.log.ErrorContext(fCtx.Context(), "could not check rate limit",
+			slog.String("route", route), sl.Err(err))
+		return fCtx.Next()
+	}
+
+	fCtx.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(limit.Period)))
+	fCtx.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	fCtx.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	fCtx.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+	if !res.Allowed {
+		fCtx.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		return fiber.NewError(http.StatusTooManyRequests, "rate limit exceeded")
+	}
+
+	return fCtx.Next()
+}
+
+func passThrough(fCtx fiber.Ctx) error {
+	return fCtx.Next()
+}
+
+func rateLimitSubject(fCtx fiber.Ctx, key RateLimitKey) string {
+	if key == RateLimitByIP {
+		return "ip:" + fCtx.IP()
+	}
+
+	p, ok := PrincipalFromContext(fCtx.Context())
+	if !ok || p.Subject == "" {
+		return "ip:" + fCtx.IP()
+	}
+
+	isAPIKey := strings.HasPrefix(p.Subject, apiKeySubjectPrefix)
+	switch {
+	case isAPIKey:
+		return p.Subject
+	case key == RateLimitByPrincipal:
+		return "user:" + p.Subject
+	default:
+		return "ip:" + fCtx.IP()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"unicode"
+)
+
+// requestIDMaxLen limits the accepted IDs, so the clients can not flood the logs
+const requestIDMaxLen = 128
+
+// RequestID accepts or generates the X-Request-ID header and the X-Correlation-ID header defaulting to it,
+// puts them on the request context and echoes them in the response
+func RequestID() fiber.Handler {
+	return func(fCtx fiber.Ctx) error {
+		requestID := fCtx.Get(sl.HeaderRequestID)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		correlationID := fCtx.Get(sl.HeaderCorrelationID)
+		if !validRequestID(correlationID) {
+			correlationID = requestID
+		}
+
+		ctx := sl.WithRequestID(fCtx.Context(), requestID)
+		fCtx.SetContext(sl.WithCorrelationID(ctx, correlationID))
+
+		fCtx.Set(sl.HeaderRequestID, requestID)
+		fCtx.Set(sl.HeaderCorrelationID, correlationID)
+
+		return fCtx.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLen {
+		return false
+	}
+
+	for _, r := range id {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/akimsavvin/test_go/internal/presentation/rest")
+
+// requestCarrier adapts the request headers to propagation.TextMapCarrier
+type requestCarrier struct {
+	fCtx fiber.Ctx
+}
+
+var _ propagation.TextMapCarrier = requestCarrier{}
+
+func (c requestCarrier) Get(key string) string {
+	return c.fCtx.Get(key)
+}
+
+func (c requestCarrier) Set(key, value string) {
+	c.fCtx.Request().Header.Set(key, value)
+}
+
+func (c requestCarrier) Keys() []string {
+	keys := make([]string, 0, c.fCtx.Request().Header.Len())
+	for key := range c.fCtx.GetReqHeaders() {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Trace starts a server span for every request continuing the trace of the incoming trace context headers,
+// it must be used by the application before the routes
+func Trace() fiber.Handler {
+	return func(fCtx fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(fCtx.Context(), requestCarrier{fCtx})
+		ctx, span := tracer.Start(ctx, fCtx.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(fCtx.Method()),
+				semconv.URLPath(fCtx.Path()),
+				semconv.ClientAddress(fCtx.IP()),
+			),
+		)
+		defer span.End()
+
+		self := fCtx.Route()
+		fCtx.SetContext(ctx)
+
+		err := fCtx.Next()
+
+		status := fCtx.Response().StatusCode()
+		if err != nil {
+			status = errorStatus(err)
+			span.RecordError(err)
+		}
+
+		if matched := fCtx.Route(); matched != self {
+			span.SetName(fCtx.Method() + " " + matched.Path)
+			span.SetAttributes(semconv.HTTPRoute(matched.Path))
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+
+		if p, ok := PrincipalFromContext(fCtx.Context()); ok {
+			span.SetAttributes(attribute.String("enduser.id", p.Subject))
+		}
+
+		return err
+	}
+}
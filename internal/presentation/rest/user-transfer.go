@@ -0,0 +1,302 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"io"
+	"iter"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	MIMETextCSV = "text/csv"
+	MIMENDJSON  = "application/x-ndjson"
+)
+
+// exportFlushEvery is the number of exported users written before flushing the response
+const exportFlushEvery = 500
+
+// ndjsonMaxLineSize is the maximum size of a single imported NDJSON line
+const ndjsonMaxLineSize = 1 << 20
+
+var userCSVHeader = []string{"id", "created_at", "updated_at", "name", "email"}
+
+// exportErrorMessage ends a failed export, so a partial export can be told from a complete one.
+// It is the id of the last CSV record and the error of the last NDJSON line
+const exportErrorMessage = "export failed"
+
+// ExportErrorLine is the last NDJSON line of a failed export
+type ExportErrorLine struct {
+	Error string `json:"error"`
+}
+
+type ImportUserError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ImportUsersResponse struct {
+	Imported int               `json:"imported"`
+	Errors   []ImportUserError `json:"errors"`
+}
+
+func (contr *UserController) export(fCtx fiber.Ctx) error {
+	format := fCtx.Accepts(MIMETextCSV, MIMENDJSON)
+	if format == "" {
+		return fiber.NewError(http.StatusNotAcceptable,
+			fmt.Sprintf("export is available as %s or %s", MIMETextCSV, MIMENDJSON))
+	}
+
+	ctx := fCtx.Context()
+	fCtx.Set(fiber.HeaderContentType, format)
+
+	return fCtx.SendStreamWriter(func(w *bufio.Writer) {
+		var write func(*usecase.UserDTO) error
+		var writeError func() error
+		if format == MIMETextCSV {
+			cw := csv.NewWriter(w)
+			if err := cw.Write(userCSVHeader); err != nil {
+				contr.log.ErrorContext(ctx, "could not write export header", sl.Err(err))
+				return
+			}
+
+			write = func(dto *usecase.UserDTO) error {
+				cw.Write([]string{
+					dto.ID.String(),
+					dto.CreatedAt.Format(time.RFC3339Nano),
+					dto.UpdatedAt.Format(time.RFC3339Nano),
+					dto.Name,
+					dto.Email,
+				})
+				cw.Flush()
+				return cw.Error()
+			}
+			writeError = func() error {
+				cw.Write([]string{exportErrorMessage})
+				cw.Flush()
+				return cw.Error()
+			}
+		} else {
+			enc := json.NewEncoder(w)
+			write = func(dto *usecase.UserDTO) error {
+				return enc.Encode(userDtoToResponse(dto))
+			}
+			writeError = func() error {
+				return enc.Encode(ExportErrorLine{exportErrorMessage})
+			}
+		}
+
+		var written int
+		err := contr.useCase.Export(ctx, func(dto *usecase.UserDTO) error {
+			if err := write(dto); err != nil {
+				return err
+			}
+
+			written++
+			if written%exportFlushEvery == 0 {
+				return w.Flush()
+			}
+
+			return nil
+		})
+		if err != nil {
+			contr.log.ErrorContext(ctx, "could not export users", slog.Int("written", written), sl.Err(err))
+
+			// the status is already sent, the client can only tell the failure by the last record
+			if err = writeError(); err != nil {
+				contr.log.ErrorContext(ctx, "could not write export error", sl.Err(err))
+			}
+		}
+
+		if err = w.Flush(); err != nil {
+			contr.log.ErrorContext(ctx, "could not flush export", sl.Err(err))
+		}
+	})
+}
+
+func (contr *UserController) importUsers(fCtx fiber.Ctx) error {
+	mediaType, _, err := mime.ParseMediaType(fCtx.Get(fiber.HeaderContentType))
+	if err != nil || (mediaType != MIMETextCSV && mediaType != MIMENDJSON) {
+		return fiber.NewError(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("content type must be %s or %s", MIMETextCSV, MIMENDJSON))
+	}
+
+	body := fCtx.Request().BodyStream()
+	if body == nil {
+		body = bytes.NewReader(fCtx.Body())
+	}
+
+	var records iter.Seq[usecase.ImportUserRecord]
+	if mediaType == MIMETextCSV {
+		records, err = csvImportRecords(body)
+		if err != nil {
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+	} else {
+		records = ndjsonImportRecords(body)
+	}
+
+	res, err := contr.useCase.Import(fCtx.Context(), records, contr.cfg.ImportBatchSize)
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	resp := ImportUsersResponse{
+		Imported: res.Imported,
+		Errors:   make([]ImportUserError, 0, len(res.Errors)),
+	}
+	for _, e := range res.Errors {
+		resp.Errors = append(resp.Errors, ImportUserError{e.Line, e.Err.Error()})
+	}
+
+	return fCtx.Status(fiber.StatusOK).JSON(resp)
+}
+
+// csvImportRecords reads the header and returns the records of the CSV,
+// only the name and email columns are required
+func csvImportRecords(r io.Reader) (iter.Seq[usecase.ImportUserRecord], error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, col := range header {
+		columns[strings.TrimSpace(strings.ToLower(col))] = i
+	}
+
+	for _, required := range []string{"name", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv header must contain the %s column", required)
+		}
+	}
+
+	return func(yield func(usecase.ImportUserRecord) bool) {
+		for {
+			row, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if err != nil {
+				var parseErr *csv.ParseError
+				if !errors.As(err, &parseErr) {
+					yield(usecase.ImportUserRecord{Err: err})
+					return
+				}
+
+				if !yield(usecase.ImportUserRecord{Line: parseErr.StartLine, Err: err}) {
+					return
+				}
+
+				continue
+			}
+
+			line, _ := cr.FieldPos(0)
+			dto, err := csvRowToImportDTO(columns, row)
+			if !yield(usecase.ImportUserRecord{Line: line, User: dto, Err: err}) {
+				return
+			}
+		}
+	}, nil
+}
+
+func csvRowToImportDTO(columns map[string]int, row []string) (*usecase.ImportUserDTO, error) {
+	value := func(col string) string {
+		if i, ok := columns[col]; ok {
+			return row[i]
+		}
+
+		return ""
+	}
+
+	dto := &usecase.ImportUserDTO{
+		Name:  value("name"),
+		Email: value("email"),
+	}
+
+	var err error
+	if v := value("id"); v != "" {
+		if dto.ID, err = uuid.Parse(v); err != nil {
+			return nil, fmt.Errorf("invalid id: %w", err)
+		}
+	}
+
+	if v := value("created_at"); v != "" {
+		if dto.CreatedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, fmt.Errorf("invalid created_at: %w", err)
+		}
+	}
+
+	if v := value("updated_at"); v != "" {
+		if dto.UpdatedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, fmt.Errorf("invalid updated_at: %w", err)
+		}
+	}
+
+	return dto, nil
+}
+
+// importUserLine is a single line of an NDJSON import,
+// it has the same shape as UserResponse, so an export can be imported back
+type importUserLine struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+}
+
+func ndjsonImportRecords(r io.Reader) iter.Seq[usecase.ImportUserRecord] {
+	return func(yield func(usecase.ImportUserRecord) bool) {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 64*1024), ndjsonMaxLineSize)
+
+		var line int
+		for sc.Scan() {
+			line++
+			if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+				continue
+			}
+
+			var rec usecase.ImportUserRecord
+			rec.Line = line
+
+			var l importUserLine
+			if err := decodeStrict(sc.Bytes(), &l); err != nil {
+				rec.Err = err
+			} else {
+				rec.User = &usecase.ImportUserDTO{
+					ID:        l.ID,
+					CreatedAt: l.CreatedAt,
+					UpdatedAt: l.UpdatedAt,
+					Name:      l.Name,
+					Email:     l.Email,
+				}
+			}
+
+			if !yield(rec) {
+				return
+			}
+		}
+
+		if err := sc.Err(); err != nil {
+			yield(usecase.ImportUserRecord{Line: line + 1, Err: err})
+		}
+	}
+}
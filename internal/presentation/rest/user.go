@@ -1,24 +1,66 @@
 package rest
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/akimsavvin/test_go/internal/domain"
 	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/evanphx/json-patch/v5"
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
+	"log/slog"
+	"mime"
 	"net/http"
 	"time"
 )
 
+const (
+	MIMEMergePatchJSON = "application/merge-patch+json"
+	MIMEJSONPatchJSON  = "application/json-patch+json"
+)
+
 type CreateUserRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name  string `json:"name" validate:"required,max=255"`
+	Email string `json:"email" validate:"required,email,max=255"`
 }
 
 type UpdateUserRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name  string `json:"name" validate:"required,max=255"`
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// PatchUserDocument is the patchable representation of a user
+// that JSON Merge Patch and JSON Patch documents are applied to
+type PatchUserDocument struct {
+	Name  *string `json:"name" validate:"required,max=255"`
+	Email *string `json:"email" validate:"required,email,max=255"`
+}
+
+const (
+	BatchModeAtomic     = "atomic"
+	BatchModeBestEffort = "best_effort"
+)
+
+type BatchUserOperation struct {
+	Op    string    `json:"op" validate:"required,oneof=create update delete"`
+	ID    uuid.UUID `json:"id" validate:"required_unless=Op create"`
+	Name  *string   `json:"name" validate:"omitempty,max=255"`
+	Email *string   `json:"email" validate:"omitempty,email,max=255"`
+}
+
+type BatchUsersRequest struct {
+	Mode       string               `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Operations []BatchUserOperation `json:"operations" validate:"required,min=1,dive"`
+}
+
+// JSONPatchOperation is a single RFC 6902 operation, it documents the JSON Patch requests
+type JSONPatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
 }
 
 type CreateUserResponse struct {
@@ -33,6 +75,16 @@ type UserResponse struct {
 	Email     string    `json:"email"`
 }
 
+type BatchUserResult struct {
+	Status int        `json:"status"`
+	ID     *uuid.UUID `json:"id,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+type BatchUsersResponse struct {
+	Results []BatchUserResult `json:"results"`
+}
+
 func userDtoToResponse(dto *usecase.UserDTO) *UserResponse {
 	return &UserResponse{
 		ID:        dto.ID,
@@ -43,22 +95,170 @@ func userDtoToResponse(dto *usecase.UserDTO) *UserResponse {
 	}
 }
 
+type UserControllerConfig struct {
+	// MaxBatchSize is the maximum number of operations in a batch request
+	MaxBatchSize int
+
+	// ImportBatchSize is the number of imported users inserted at once
+	ImportBatchSize int
+
+	// RateLimiter limits the routes, nil does not limit them
+	RateLimiter *RateLimiter
+}
+
 type UserController struct {
+	log     *slog.Logger
+	cfg     UserControllerConfig
 	useCase usecase.UserUseCase
 }
 
-func NewUserController(useCase usecase.UserUseCase) *UserController {
+func NewUserController(log *slog.Logger, cfg UserControllerConfig, useCase usecase.UserUseCase) *UserController {
 	return &UserController{
+		log:     log.With(sl.Op("rest.UserController")),
+		cfg:     cfg,
 		useCase: useCase,
 	}
 }
 
 func (contr *UserController) Init(root fiber.Router) {
+	canRead := Authorize(IsSelf("id"), HasRole(RoleAdmin), HasScope(ScopeUsersRead))
+	canWrite := Authorize(IsSelf("id"), HasRole(RoleAdmin), HasScope(ScopeUsersWrite))
+	canReadAll := Authorize(HasRole(RoleAdmin), HasScope(ScopeUsersRead))
+	canWriteAll := Authorize(HasRole(RoleAdmin), HasScope(ScopeUsersWrite))
+	isAdmin := Authorize(HasRole(RoleAdmin))
+
+	limit := contr.cfg.RateLimiter.For
+
+	root.Post("/users\\:batch", contr.batch, canWriteAll, limit(http.MethodPost, "/users\\:batch"))
+
 	g := root.Group("/users")
-	g.Get("/:id", contr.getById)
-	g.Post("/", contr.create)
-	g.Put("/:id", contr.update)
-	g.Delete("/:id", contr.delete)
+	g.Get("/export", contr.export, canReadAll, limit(http.MethodGet, "/users/export"))
+	g.Post("/import", contr.importUsers, canWriteAll, limit(http.MethodPost, "/users/import"))
+	g.Get("/:id", contr.getById, canRead, limit(http.MethodGet, "/users/:id"))
+	g.Post("/", contr.create, canWriteAll, limit(http.MethodPost, "/users/"))
+	g.Put("/:id", contr.update, canWrite, limit(http.MethodPut, "/users/:id"))
+	g.Patch("/:id", contr.patch, canWrite, limit(http.MethodPatch, "/users/:id"))
+	g.Delete("/:id", contr.delete, isAdmin, limit(http.MethodDelete, "/users/:id"))
+}
+
+func (contr *UserController) Operations() []Operation {
+	tags := []string{"users"}
+	idParam := Parameter{
+		Name:        "id",
+		In:          "path",
+		Description: "user identifier",
+		Schema:      uuid.UUID{},
+	}
+
+	return []Operation{
+		{
+			Method:      http.MethodPost,
+			Path:        "/users\\:batch",
+			Summary:     "Run mixed create, update and delete operations",
+			Tags:        tags,
+			RequestBody: &RequestBody{JSONContent(BatchUsersRequest{})},
+			Responses: map[int]Response{
+				http.StatusOK:                    {"operations results", JSONContent(BatchUsersResponse{})},
+				http.StatusBadRequest:            {"invalid batch", nil},
+				http.StatusRequestEntityTooLarge: {"too many operations", nil},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/users/export",
+			Summary: "Stream all the users as CSV or NDJSON, a failed export ends with an error record",
+			Tags:    tags,
+			Responses: map[int]Response{
+				http.StatusOK: {"exported users", Content{
+					MIMETextCSV: "",
+					MIMENDJSON:  UserResponse{},
+				}},
+				http.StatusNotAcceptable: {"unsupported export format", nil},
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/users/import",
+			Summary: "Import users from CSV or NDJSON",
+			Tags:    tags,
+			RequestBody: &RequestBody{Content{
+				MIMETextCSV: "",
+				MIMENDJSON:  importUserLine{},
+			}},
+			Responses: map[int]Response{
+				http.StatusOK:                   {"import report", JSONContent(ImportUsersResponse{})},
+				http.StatusBadRequest:           {"invalid CSV header", nil},
+				http.StatusUnsupportedMediaType: {"unsupported import format", nil},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/users/:id",
+			Summary: "Get a user by identifier",
+			Tags:    tags,
+			Params:  []Parameter{idParam},
+			Responses: map[int]Response{
+				http.StatusOK:         {"user", JSONContent(UserResponse{})},
+				http.StatusBadRequest: {"invalid identifier", nil},
+				http.StatusNotFound:   {"user not found", nil},
+			},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/users/",
+			Summary:     "Create a user",
+			Tags:        tags,
+			RequestBody: &RequestBody{JSONContent(CreateUserRequest{})},
+			Responses: map[int]Response{
+				http.StatusOK:                  {"created user identifier", JSONContent(CreateUserResponse{})},
+				http.StatusBadRequest:          {"invalid request", nil},
+				http.StatusUnprocessableEntity: {"invalid user", nil},
+			},
+		},
+		{
+			Method:      http.MethodPut,
+			Path:        "/users/:id",
+			Summary:     "Replace the user attributes",
+			Tags:        tags,
+			Params:      []Parameter{idParam},
+			RequestBody: &RequestBody{JSONContent(UpdateUserRequest{})},
+			Responses: map[int]Response{
+				http.StatusOK:                  {"user updated", nil},
+				http.StatusNotFound:            {"user not found", nil},
+				http.StatusUnprocessableEntity: {"invalid user", nil},
+			},
+		},
+		{
+			Method:  http.MethodPatch,
+			Path:    "/users/:id",
+			Summary: "Partially update the user with JSON Merge Patch or JSON Patch",
+			Tags:    tags,
+			Params:  []Parameter{idParam},
+			RequestBody: &RequestBody{Content{
+				MIMEMergePatchJSON: PatchUserDocument{},
+				MIMEJSONPatchJSON:  []JSONPatchOperation{},
+			}},
+			Responses: map[int]Response{
+				http.StatusOK:                   {"user updated", nil},
+				http.StatusBadRequest:           {"invalid patch", nil},
+				http.StatusNotFound:             {"user not found", nil},
+				http.StatusConflict:             {"JSON Patch test operation failed", nil},
+				http.StatusUnsupportedMediaType: {"unsupported patch format", nil},
+				http.StatusUnprocessableEntity:  {"invalid patched user", nil},
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/users/:id",
+			Summary: "Delete the user",
+			Tags:    tags,
+			Params:  []Parameter{idParam},
+			Responses: map[int]Response{
+				http.StatusNoContent: {"user deleted", nil},
+				http.StatusNotFound:  {"user not found", nil},
+			},
+		},
+	}
 }
 
 func (contr *UserController) getById(fCtx fiber.Ctx) error {
@@ -81,8 +281,8 @@ func (contr *UserController) getById(fCtx fiber.Ctx) error {
 
 func (contr *UserController) create(fCtx fiber.Ctx) error {
 	var req CreateUserRequest
-	if err := fCtx.Bind().Body(&req); err != nil {
-		return fiber.ErrBadRequest
+	if err := bindBody(fCtx, &req); err != nil {
+		return err
 	}
 
 	dto := &usecase.CreateUserDTO{
@@ -92,7 +292,7 @@ func (contr *UserController) create(fCtx fiber.Ctx) error {
 
 	id, err := contr.useCase.Create(fCtx.Context(), dto)
 	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, err.Error())
+		return userError(err)
 	}
 
 	fCtx.Set("Content-Location", fmt.Sprintf("/api/v1/users/%s", id.String()))
@@ -106,24 +306,214 @@ func (contr *UserController) update(fCtx fiber.Ctx) error {
 	}
 
 	var req UpdateUserRequest
-	if err = fCtx.Bind().Body(&req); err != nil {
+	if err = bindBody(fCtx, &req); err != nil {
 		return err
 	}
 
 	dto := &usecase.UpdateUserDTO{
-		Name:  req.Name,
-		Email: req.Email,
+		Name:  &req.Name,
+		Email: &req.Email,
 	}
 
 	if err = contr.useCase.Update(fCtx.Context(), id, dto); err != nil {
-		if errors.Is(err, domain.ErrUserNotFound) {
-			return fiber.NewError(http.StatusNotFound, err.Error())
+		return userError(err)
+	}
+
+	return fCtx.Status(fiber.StatusOK).Send(nil)
+}
+
+func (contr *UserController) patch(fCtx fiber.Ctx) error {
+	id, err := uuid.Parse(fCtx.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, "id is not a valid uuid")
+	}
+
+	mediaType, _, err := mime.ParseMediaType(fCtx.Get(fiber.HeaderContentType))
+	if err != nil || (mediaType != MIMEMergePatchJSON && mediaType != MIMEJSONPatchJSON) {
+		return fiber.NewError(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("content type must be %s or %s", MIMEMergePatchJSON, MIMEJSONPatchJSON))
+	}
+
+	body, err := readBody(fCtx)
+	if err != nil {
+		return err
+	}
+
+	// the patch errors are already the HTTP errors
+	var patchErr error
+	err = contr.useCase.Patch(fCtx.Context(), id, func(current *usecase.UserDTO) (*usecase.UpdateUserDTO, error) {
+		dto, err := applyUserPatch(current, mediaType, body)
+		patchErr = err
+		return dto, err
+	})
+	if patchErr != nil {
+		return patchErr
+	}
+	if err != nil {
+		return userError(err)
+	}
+
+	return fCtx.Status(fiber.StatusOK).Send(nil)
+}
+
+// applyUserPatch applies the patch of the media type to the current user and returns the changed attributes
+func applyUserPatch(current *usecase.UserDTO, mediaType string, body []byte) (*usecase.UpdateUserDTO, error) {
+	doc, err := json.Marshal(PatchUserDocument{
+		Name:  &current.Name,
+		Email: &current.Email,
+	})
+	if err != nil {
+		return nil, fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	var patched []byte
+	if mediaType == MIMEMergePatchJSON {
+		patched, err = jsonpatch.MergePatch(doc, body)
+		if err != nil {
+			return nil, fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+	} else {
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+
+		patched, err = patch.Apply(doc)
+		if err != nil {
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				return nil, fiber.NewError(http.StatusConflict, err.Error())
+			}
+
+			return nil, fiber.NewError(http.StatusUnprocessableEntity, err.Error())
 		}
+	}
+
+	var res PatchUserDocument
+	if err = decodeStrict(patched, &res); err != nil {
+		return nil, fiber.NewError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	if err = validateStruct(&res); err != nil {
+		return nil, err
+	}
 
+	var dto usecase.UpdateUserDTO
+	if *res.Name != current.Name {
+		dto.Name = res.Name
+	}
+	if *res.Email != current.Email {
+		dto.Email = res.Email
+	}
+
+	return &dto, nil
+}
+
+func (contr *UserController) batch(fCtx fiber.Ctx) error {
+	var req BatchUsersRequest
+	if err := bindBody(fCtx, &req); err != nil {
+		return err
+	}
+
+	atomic := req.Mode != BatchModeBestEffort
+
+	if len(req.Operations) > contr.cfg.MaxBatchSize {
+		return fiber.NewError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("batch must contain at most %d operations", contr.cfg.MaxBatchSize))
+	}
+
+	ops := make([]usecase.BatchOperationDTO, 0, len(req.Operations))
+	for _, op := range req.Operations {
+		ops = append(ops, batchOperationToDTO(op))
+	}
+
+	results, err := contr.useCase.Batch(fCtx.Context(), ops, atomic)
+	if err != nil && !errors.Is(err, usecase.ErrBatchFailed) {
 		return fiber.NewError(http.StatusInternalServerError, err.Error())
 	}
 
-	return fCtx.Status(fiber.StatusOK).Send(nil)
+	status := fiber.StatusOK
+	res := BatchUsersResponse{
+		Results: make([]BatchUserResult, 0, len(results)),
+	}
+	for i, result := range results {
+		item := batchResultToResponse(ops[i].Type, result)
+
+		// a failed atomic batch is answered with the status of the failed operation
+		if err != nil && result.Err != nil && !errors.Is(result.Err, usecase.ErrBatchOperationSkipped) {
+			status = item.Status
+		}
+
+		res.Results = append(res.Results, item)
+	}
+
+	return fCtx.Status(status).JSON(res)
+}
+
+func batchOperationToDTO(op BatchUserOperation) usecase.BatchOperationDTO {
+	dto := usecase.BatchOperationDTO{
+		Type: usecase.BatchOperationType(op.Op),
+		ID:   op.ID,
+	}
+
+	switch dto.Type {
+	case usecase.BatchCreate:
+		dto.Create = &usecase.CreateUserDTO{}
+		if op.Name != nil {
+			dto.Create.Name = *op.Name
+		}
+		if op.Email != nil {
+			dto.Create.Email = *op.Email
+		}
+	case usecase.BatchUpdate:
+		dto.Update = &usecase.UpdateUserDTO{
+			Name:  op.Name,
+			Email: op.Email,
+		}
+	}
+
+	return dto
+}
+
+func batchResultToResponse(typ usecase.BatchOperationType, result usecase.BatchResultDTO) BatchUserResult {
+	if result.Err != nil {
+		var fErr *fiber.Error
+		switch {
+		case errors.Is(result.Err, usecase.ErrBatchOperationSkipped):
+			fErr = fiber.NewError(http.StatusFailedDependency, result.Err.Error())
+		case errors.Is(result.Err, usecase.ErrUnknownBatchOperation):
+			fErr = fiber.NewError(http.StatusBadRequest, result.Err.Error())
+		default:
+			errors.As(userError(result.Err), &fErr)
+		}
+
+		return BatchUserResult{
+			Status: fErr.Code,
+			Error:  fErr.Message,
+		}
+	}
+
+	switch typ {
+	case usecase.BatchCreate:
+		return BatchUserResult{
+			Status: http.StatusCreated,
+			ID:     &result.ID,
+		}
+	case usecase.BatchDelete:
+		return BatchUserResult{Status: http.StatusNoContent}
+	default:
+		return BatchUserResult{Status: http.StatusOK}
+	}
+}
+
+func userError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrInvalidUserName), errors.Is(err, domain.ErrInvalidUserEmail):
+		return fiber.NewError(http.StatusUnprocessableEntity, err.Error())
+	default:
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
 }
 
 func (contr *UserController) delete(fCtx fiber.Ctx) error {
@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v3"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// report the fields by their JSON names
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
+	return v
+}
+
+// bindBody strictly decodes the JSON body rejecting unknown fields and validates the result
+func bindBody(fCtx fiber.Ctx, target any) error {
+	mediaType, _, err := mime.ParseMediaType(fCtx.Get(fiber.HeaderContentType))
+	if err != nil || mediaType != fiber.MIMEApplicationJSON {
+		return fiber.NewError(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("content type must be %s", fiber.MIMEApplicationJSON))
+	}
+
+	body, err := readBody(fCtx)
+	if err != nil {
+		return err
+	}
+
+	if err = decodeStrict(body, target); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid request body: "+err.Error())
+	}
+
+	return validateStruct(target)
+}
+
+// readBody returns the request body, the server does not limit the bodies it streams,
+// so a streamed body is read up to the app body limit
+func readBody(fCtx fiber.Ctx) ([]byte, error) {
+	req := fCtx.Request()
+	if !req.IsBodyStream() {
+		return fCtx.Body(), nil
+	}
+
+	limit := fCtx.App().Config().BodyLimit
+	body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(limit)+1))
+	if err != nil {
+		return nil, fiber.NewError(http.StatusBadRequest, "could not read request body: "+err.Error())
+	}
+
+	if len(body) > limit {
+		return nil, fiber.ErrRequestEntityTooLarge
+	}
+
+	// the body is set back to be decoded by its content encoding
+	req.SetBody(body)
+	return fCtx.Body(), nil
+}
+
+// decodeStrict decodes the single JSON value rejecting unknown fields
+func decodeStrict(data []byte, target any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(target); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after the JSON value")
+	}
+
+	return nil
+}
+
+// validateStruct validates the struct by its "validate" tags and returns a ValidationError
+func validateStruct(target any) error {
+	err := validate.Struct(target)
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	vErr := &ValidationError{
+		Fields: make([]FieldError, 0, len(fieldErrs)),
+	}
+	for _, fe := range fieldErrs {
+		// the namespace starts with the struct name
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+
+		vErr.Fields = append(vErr.Fields, FieldError{
+			Field:   field,
+			Message: fieldErrorMessage(fe),
+		})
+	}
+
+	return vErr
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at most %s items", fe.Param())
+		}
+
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "min":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at least %s items", fe.Param())
+		}
+
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	default:
+		return fmt.Sprintf("failed the %s validation", fe.Tag())
+	}
+}
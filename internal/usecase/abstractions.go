@@ -4,6 +4,8 @@ import (
 	"context"
 	"github.com/akimsavvin/test_go/internal/domain"
 	"github.com/google/uuid"
+	"iter"
+	"time"
 )
 
 // UserUseCase is a use cases for domain.User
@@ -14,17 +16,40 @@ type UserUseCase interface {
 	// Create creates a new user and returns its identifier
 	Create(ctx context.Context, dto *CreateUserDTO) (uuid.UUID, error)
 
-	// Update updates an existing user by its identifier
+	// Update updates the provided attributes of an existing user by its identifier
 	Update(ctx context.Context, id uuid.UUID, dto *UpdateUserDTO) error
 
+	// Patch updates the user with the attributes returned by patch for its current state,
+	// both read and written in a single unit of work. The error of patch is returned as is
+	Patch(ctx context.Context, id uuid.UUID, patch func(current *UserDTO) (*UpdateUserDTO, error)) error
+
 	// Delete deletes the user by its identifier
 	Delete(ctx context.Context, id uuid.UUID) error
+
+	// Batch runs the operations and returns a result per operation.
+	// If atomic is true, all the operations run in a single unit of work
+	// and ErrBatchFailed is returned when any of them fails
+	Batch(ctx context.Context, ops []BatchOperationDTO, atomic bool) ([]BatchResultDTO, error)
+
+	// Export calls fn for every user until it returns an error
+	Export(ctx context.Context, fn func(*UserDTO) error) error
+
+	// Import validates and inserts the users in batches of batchSize without publishing events
+	// and returns the number of imported users with the per-line errors,
+	// a failed user does not prevent the others of its batch from being imported
+	Import(ctx context.Context, records iter.Seq[ImportUserRecord], batchSize int) (*ImportResultDTO, error)
+
+	// Reindex refreshes the cached users from the storage and returns the number of them
+	Reindex(ctx context.Context) (int, error)
 }
 
 // UserReadRepo is the domain.User read repository
 type UserReadRepo interface {
 	// GetByID returns a user by identifier
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
+
+	// ForEach calls fn for every user streaming them from the storage until fn returns an error
+	ForEach(ctx context.Context, fn func(*domain.User) error) error
 }
 
 // UserRepo is the domain.User repository
@@ -38,6 +63,35 @@ type UserRepo interface {
 	Remove(ctx context.Context, user *domain.User) error
 }
 
+// APIKeyUseCase is a use cases for domain.APIKey
+type APIKeyUseCase interface {
+	// Issue issues a new API key, the plain key is returned only once
+	Issue(ctx context.Context, dto *IssueAPIKeyDTO) (*IssuedAPIKeyDTO, error)
+
+	// Revoke revokes the API key by its identifier
+	Revoke(ctx context.Context, id uuid.UUID) error
+
+	// Authenticate returns the active API key matching the plain key or ErrInvalidAPIKey
+	Authenticate(ctx context.Context, key string) (*APIKeyDTO, error)
+}
+
+// APIKeyReadRepo is the domain.APIKey read repository
+type APIKeyReadRepo interface {
+	// GetByHash returns an API key by the hash of the plain key
+	GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+}
+
+// APIKeyRepo is the domain.APIKey repository
+type APIKeyRepo interface {
+	APIKeyReadRepo
+
+	// GetByID returns an API key by identifier
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.APIKey, error)
+
+	// Insert inserts an API key into the repository
+	Insert(ctx context.Context, key *domain.APIKey) error
+}
+
 // UnitOfWorkBase contains Save and Cancel methods
 type UnitOfWorkBase interface {
 	// Save saves changes in the repositories
@@ -53,6 +107,13 @@ type UnitOfWork interface {
 
 	// Users returns the user repository
 	Users() UserRepo
+
+	// APIKeys returns the API key repository
+	APIKeys() APIKeyRepo
+
+	// Savepoint writes the pending changes and then runs fn and writes its changes under a savepoint.
+	// If either fails, only the changes since the savepoint are rolled back and the entities are no longer tracked
+	Savepoint(fn func() error) error
 }
 
 // UnitOfReadWork manages read repositories in a single read unit
@@ -61,6 +122,15 @@ type UnitOfReadWork interface {
 
 	// Users returns the user read repository
 	Users() UserReadRepo
+
+	// APIKeys returns the API key read repository
+	APIKeys() APIKeyReadRepo
+}
+
+// APIKeyUsageRepo records the API keys usage outside the units of work
+type APIKeyUsageRepo interface {
+	// MarkUsed sets the last usage time of the API key unless a later one is already set
+	MarkUsed(ctx context.Context, id uuid.UUID, at time.Time) error
 }
 
 // UnitOfWorkFactory creates a new UnitOfWork
@@ -0,0 +1,42 @@
+package usecase
+
+import (
+	"github.com/akimsavvin/test_go/internal/domain"
+	"github.com/google/uuid"
+	"time"
+)
+
+type APIKeyDTO struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	Name       string
+	Scopes     []string
+	ExpiresAt  time.Time
+	RevokedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// IssueAPIKeyDTO contains the attributes of a new API key, zero ExpiresAt means the key never expires
+type IssueAPIKeyDTO struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// IssuedAPIKeyDTO contains the issued API key with the plain key shown only once
+type IssuedAPIKeyDTO struct {
+	APIKeyDTO
+	Key string
+}
+
+func apiKeyToDTO(key *domain.APIKey) *APIKeyDTO {
+	return &APIKeyDTO{
+		ID:         key.ID(),
+		CreatedAt:  key.CreatedAt(),
+		Name:       key.Name(),
+		Scopes:     key.Scopes(),
+		ExpiresAt:  key.ExpiresAt(),
+		RevokedAt:  key.RevokedAt(),
+		LastUsedAt: key.LastUsedAt(),
+	}
+}
@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"github.com/akimsavvin/test_go/internal/domain"
+	"github.com/akimsavvin/test_go/pkg/cache"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/google/uuid"
+	"log/slog"
+	"time"
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked and expired API keys alike
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+const (
+	// apiKeyCacheTTL bounds both the time a revoked key may stay cached on a cache failure
+	// and how often the key last usage time is written
+	apiKeyCacheTTL = time.Minute
+
+	// apiKeyInvalidCacheTTL is the time an unknown or inactive key is rejected without a storage lookup,
+	// it is short, as a key issued meanwhile is not evicted
+	apiKeyInvalidCacheTTL = 10 * time.Second
+
+	// apiKeyRevokedCacheTTL is the time a revoked key is rejected without a lookup on the slave,
+	// it outlasts the replication lag, so the slave does not cache the key as active again
+	apiKeyRevokedCacheTTL = time.Hour
+
+	// apiKeyUsageTimeout bounds the write of the key last usage time done in the background
+	apiKeyUsageTimeout = 5 * time.Second
+)
+
+type apiKeyUseCaseImpl struct {
+	log       *slog.Logger
+	ufw       UnitOfWorkFactory
+	usage     APIKeyUsageRepo
+	jsonCache cache.JsonCache
+	tasks     *BackgroundTasks
+}
+
+func NewAPIKeyUseCase(
+	log *slog.Logger,
+	ufw UnitOfWorkFactory,
+	usage APIKeyUsageRepo,
+	jc cache.JsonCache,
+	tasks *BackgroundTasks) APIKeyUseCase {
+	return &apiKeyUseCaseImpl{
+		log:       log,
+		ufw:       ufw,
+		usage:     usage,
+		jsonCache: jc,
+		tasks:     tasks,
+	}
+}
+
+func apiKeyCacheKey(keyHash string) string {
+	return "api_key:" + keyHash
+}
+
+func (useCase *apiKeyUseCaseImpl) Issue(ctx context.Context, dto *IssueAPIKeyDTO) (*IssuedAPIKeyDTO, error) {
+	log := useCase.log.With(sl.Op("Issue"))
+
+	key, plain, err := domain.IssueAPIKey(dto.Name, dto.Scopes, dto.ExpiresAt)
+	if err != nil {
+		log.ErrorContext(ctx, "could not generate api key", sl.Err(err))
+		return nil, err
+	}
+
+	if err = key.Validate(); err != nil {
+		return nil, err
+	}
+
+	unit, err := useCase.ufw.StartWork(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unit.Cancel()
+
+	if err = unit.APIKeys().Insert(ctx, key); err != nil {
+		return nil, err
+	}
+
+	if err = unit.Save(); err != nil {
+		return nil, err
+	}
+
+	log.InfoContext(ctx, "issued api key", slog.String("api_key_id", key.ID().String()))
+	return &IssuedAPIKeyDTO{
+		APIKeyDTO: *apiKeyToDTO(key),
+		Key:       plain,
+	}, nil
+}
+
+func (useCase *apiKeyUseCaseImpl) Revoke(ctx context.Context, id uuid.UUID) error {
+	log := useCase.log.With(sl.Op("Revoke"), slog.String("api_key_id", id.String()))
+
+	unit, err := useCase.ufw.StartWork(ctx)
+	if err != nil {
+		return err
+	}
+	defer unit.Cancel()
+
+	key, err := unit.APIKeys().GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	key.Revoke()
+	if err = unit.Save(); err != nil {
+		return err
+	}
+
+	// the key is cached as invalid rather than evicted, so a lagging slave does not authenticate it again
+	cacheKey := apiKeyCacheKey(key.KeyHash())
+	if !useCase.cacheInvalid(ctx, log, cacheKey, apiKeyRevokedCacheTTL) {
+		if err = useCase.jsonCache.Del(ctx, cacheKey); err != nil {
+			log.ErrorContext(ctx, "could not evict revoked api key", sl.Err(err))
+		}
+	}
+
+	log.InfoContext(ctx, "revoked api key")
+	return nil
+}
+
+// Authenticate looks the key up on the slave and caches the result, the unknown and inactive keys included,
+// so neither the valid nor the bogus keys reach the storage on every request
+func (useCase *apiKeyUseCaseImpl) Authenticate(ctx context.Context, plain string) (*APIKeyDTO, error) {
+	log := useCase.log.With(sl.Op("Authenticate"))
+
+	now := time.Now()
+	keyHash := domain.HashAPIKey(plain)
+	cacheKey := apiKeyCacheKey(keyHash)
+
+	// the invalid keys are cached with the nil identifier
+	dto := &APIKeyDTO{}
+	if err := useCase.jsonCache.Get(ctx, cacheKey, dto); err == nil {
+		if dto.ID != uuid.Nil && (dto.ExpiresAt.IsZero() || now.Before(dto.ExpiresAt)) {
+			return dto, nil
+		}
+
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := useCase.getByHash(ctx, keyHash)
+	if err != nil {
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			useCase.cacheInvalid(ctx, log, cacheKey, apiKeyInvalidCacheTTL)
+			return nil, ErrInvalidAPIKey
+		}
+
+		return nil, err
+	}
+
+	if !key.IsActive(now) {
+		log.InfoContext(ctx, "rejected inactive api key", slog.String("api_key_id", key.ID().String()))
+		useCase.cacheInvalid(ctx, log, cacheKey, apiKeyInvalidCacheTTL)
+		return nil, ErrInvalidAPIKey
+	}
+
+	// the usage is recorded on cache misses only, so it is written at most once per apiKeyCacheTTL
+	useCase.markUsed(ctx, log, key.ID(), now)
+
+	dto = apiKeyToDTO(key)
+	if err = useCase.jsonCache.Set(ctx, cacheKey, dto, cache.WithExpiration(apiKeyCacheTTL)); err != nil {
+		log.ErrorContext(ctx, "could not cache api key", sl.Err(err))
+	}
+
+	return dto, nil
+}
+
+func (useCase *apiKeyUseCaseImpl) getByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	unit, err := useCase.ufw.StartReadWork(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unit.Cancel()
+
+	key, err := unit.APIKeys().GetByHash(ctx, keyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = unit.Save(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// cacheInvalid caches the key as invalid for the ttl and reports whether it succeeded
+func (useCase *apiKeyUseCaseImpl) cacheInvalid(ctx context.Context, log *slog.Logger, cacheKey string, ttl time.Duration) bool {
+	if err := useCase.jsonCache.Set(ctx, cacheKey, &APIKeyDTO{}, cache.WithExpiration(ttl)); err != nil {
+		log.ErrorContext(ctx, "could not cache invalid api key", sl.Err(err))
+		return false
+	}
+
+	return true
+}
+
+// markUsed writes the key last usage time in the background, so the request does not wait for the master
+func (useCase *apiKeyUseCaseImpl) markUsed(ctx context.Context, log *slog.Logger, id uuid.UUID, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), apiKeyUsageTimeout)
+
+	useCase.tasks.Go(func() {
+		defer cancel()
+
+		if err := useCase.usage.MarkUsed(ctx, id, at); err != nil {
+			log.WarnContext(ctx, "could not record api key usage", slog.String("api_key_id", id.String()), sl.Err(err))
+		}
+	})
+}
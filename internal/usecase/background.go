@@ -0,0 +1,42 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+)
+
+// BackgroundTasks tracks the work the use cases leave running after returning,
+// so the shutdown can wait for it before closing the storages
+type BackgroundTasks struct {
+	wg sync.WaitGroup
+}
+
+func NewBackgroundTasks() *BackgroundTasks {
+	return &BackgroundTasks{}
+}
+
+// Go runs the task in a new goroutine
+func (tasks *BackgroundTasks) Go(task func()) {
+	tasks.wg.Add(1)
+
+	go func() {
+		defer tasks.wg.Done()
+		task()
+	}()
+}
+
+// Wait waits for the running tasks until the context is done
+func (tasks *BackgroundTasks) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		tasks.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
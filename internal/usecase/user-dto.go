@@ -3,6 +3,7 @@ package usecase
 import (
 	"github.com/akimsavvin/test_go/internal/domain"
 	"github.com/google/uuid"
+	"log/slog"
 	"time"
 )
 
@@ -14,14 +15,103 @@ type UserDTO struct {
 	Email     string
 }
 
+// LogValue exposes the user fields as attributes, so the redacting handler masks the personal ones by their keys
+func (dto UserDTO) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", dto.ID.String()),
+		slog.Time("created_at", dto.CreatedAt),
+		slog.Time("updated_at", dto.UpdatedAt),
+		slog.String("name", dto.Name),
+		slog.String("email", dto.Email),
+	)
+}
+
 type CreateUserDTO struct {
 	Name  string
 	Email string
 }
 
+func (dto CreateUserDTO) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", dto.Name),
+		slog.String("email", dto.Email),
+	)
+}
+
+// UpdateUserDTO contains the user attributes to update, nil ones are left unchanged
 type UpdateUserDTO struct {
-	Name  string
-	Email string
+	Name  *string
+	Email *string
+}
+
+// BatchOperationType is the type of batch operation
+type BatchOperationType string
+
+const (
+	BatchCreate BatchOperationType = "create"
+	BatchUpdate BatchOperationType = "update"
+	BatchDelete BatchOperationType = "delete"
+)
+
+// BatchOperationDTO is a single operation of a batch,
+// Create is set for BatchCreate, ID for BatchUpdate and BatchDelete, Update for BatchUpdate
+type BatchOperationDTO struct {
+	Type   BatchOperationType
+	ID     uuid.UUID
+	Create *CreateUserDTO
+	Update *UpdateUserDTO
+}
+
+// BatchResultDTO is the result of a single batch operation, ID is the created user identifier
+type BatchResultDTO struct {
+	ID  uuid.UUID
+	Err error
+}
+
+// ImportUserDTO is an imported user, zero ID and timestamps are generated
+type ImportUserDTO struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
+	Email     string
+}
+
+// ImportUserRecord is a single line of an import, Err is set if the line could not be parsed
+type ImportUserRecord struct {
+	Line int
+	User *ImportUserDTO
+	Err  error
+}
+
+type ImportErrorDTO struct {
+	Line int
+	Err  error
+}
+
+type ImportResultDTO struct {
+	Imported int
+	Errors   []ImportErrorDTO
+}
+
+func importDtoToUser(dto *ImportUserDTO) *domain.User {
+	user := domain.CreateUser(dto.Name, dto.Email)
+	if dto.ID == uuid.Nil && dto.CreatedAt.IsZero() && dto.UpdatedAt.IsZero() {
+		return user
+	}
+
+	id, createdAt, updatedAt := dto.ID, dto.CreatedAt, dto.UpdatedAt
+	if id == uuid.Nil {
+		id = user.ID()
+	}
+	if createdAt.IsZero() {
+		createdAt = user.CreatedAt()
+	}
+	if updatedAt.IsZero() {
+		updatedAt = createdAt
+	}
+
+	return domain.NewUser(id, createdAt, updatedAt, dto.Name, dto.Email)
 }
 
 func userToDTO(user *domain.User) *UserDTO {
@@ -2,13 +2,21 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"github.com/akimsavvin/test_go/internal/domain"
 	"github.com/akimsavvin/test_go/pkg/cache"
 	"github.com/akimsavvin/test_go/pkg/sl"
 	"github.com/google/uuid"
+	"iter"
 	"log/slog"
 )
 
+var (
+	ErrBatchFailed           = errors.New("batch operation failed")
+	ErrBatchOperationSkipped = errors.New("batch operation skipped after a failure")
+	ErrUnknownBatchOperation = errors.New("unknown batch operation")
+)
+
 type userUseCaseImpl struct {
 	log       *slog.Logger
 	ufw       UnitOfWorkFactory
@@ -71,6 +79,10 @@ func (useCase *userUseCaseImpl) Create(ctx context.Context, dto *CreateUserDTO)
 	defer unit.Cancel()
 
 	user := domain.CreateUser(dto.Name, dto.Email)
+	if err = user.Validate(); err != nil {
+		return uuid.Nil, err
+	}
+
 	if err = unit.Users().Insert(ctx, user); err != nil {
 		return uuid.Nil, err
 	}
@@ -79,20 +91,55 @@ func (useCase *userUseCaseImpl) Create(ctx context.Context, dto *CreateUserDTO)
 		return uuid.Nil, err
 	}
 
-	if err = useCase.evtBus.Publish(ctx, &domain.UserCreatedEvent{
+	if err = useCase.publishCreated(ctx, user); err != nil {
+		return uuid.Nil, err
+	}
+
+	return user.ID(), nil
+}
+
+func (useCase *userUseCaseImpl) publishCreated(ctx context.Context, user *domain.User) error {
+	return useCase.evtBus.Publish(ctx, &domain.UserCreatedEvent{
 		ID:        user.ID(),
 		Name:      user.Name(),
 		Email:     user.Email(),
 		CreatedAt: user.CreatedAt(),
 		UpdatedAt: user.UpdatedAt(),
-	}); err != nil {
-		return uuid.Nil, err
+	})
+}
+
+func (useCase *userUseCaseImpl) Update(ctx context.Context, id uuid.UUID, dto *UpdateUserDTO) error {
+	unit, err := useCase.ufw.StartWork(ctx)
+	if err != nil {
+		return err
 	}
+	defer unit.Cancel()
 
-	return user.ID(), nil
+	user, err := unit.Users().GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.UpdatePartial(dto.Name, dto.Email)
+	if err = user.Validate(); err != nil {
+		return err
+	}
+
+	if err = unit.Save(); err != nil {
+		return err
+	}
+
+	if err = useCase.jsonCache.Del(ctx, id.String()); err != nil {
+	}
+
+	return nil
 }
 
-func (useCase *userUseCaseImpl) Update(ctx context.Context, id uuid.UUID, dto *UpdateUserDTO) error {
+func (useCase *userUseCaseImpl) Patch(
+	ctx context.Context,
+	id uuid.UUID,
+	patch func(current *UserDTO) (*UpdateUserDTO, error),
+) error {
 	unit, err := useCase.ufw.StartWork(ctx)
 	if err != nil {
 		return err
@@ -104,7 +151,15 @@ func (useCase *userUseCaseImpl) Update(ctx context.Context, id uuid.UUID, dto *U
 		return err
 	}
 
-	user.Update(dto.Name, dto.Email)
+	dto, err := patch(userToDTO(user))
+	if err != nil {
+		return err
+	}
+
+	user.UpdatePartial(dto.Name, dto.Email)
+	if err = user.Validate(); err != nil {
+		return err
+	}
 
 	if err = unit.Save(); err != nil {
 		return err
@@ -141,3 +196,321 @@ func (useCase *userUseCaseImpl) Delete(ctx context.Context, id uuid.UUID) error
 
 	return nil
 }
+
+func (useCase *userUseCaseImpl) Batch(ctx context.Context, ops []BatchOperationDTO, atomic bool) ([]BatchResultDTO, error) {
+	log := useCase.log.With(
+		slog.Int("operations", len(ops)),
+		slog.Bool("atomic", atomic),
+	)
+	log.DebugContext(ctx, "running batch")
+
+	if atomic {
+		return useCase.batchAtomic(ctx, log, ops)
+	}
+
+	return useCase.batchBestEffort(ctx, log, ops)
+}
+
+// batchBestEffort runs every operation under its own savepoint of a single unit of work,
+// so a failed operation does not roll back the others
+func (useCase *userUseCaseImpl) batchBestEffort(
+	ctx context.Context,
+	log *slog.Logger,
+	ops []BatchOperationDTO) ([]BatchResultDTO, error) {
+	unit, err := useCase.ufw.StartWork(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "could not run batch", sl.Err(err))
+		return nil, err
+	}
+	defer unit.Cancel()
+
+	results := make([]BatchResultDTO, len(ops))
+	created := make([]*domain.User, 0, len(ops))
+	for i, op := range ops {
+		var user *domain.User
+		err = unit.Savepoint(func() (err error) {
+			user, err = useCase.batchOperation(ctx, unit, op)
+			return err
+		})
+		if err != nil {
+			log.InfoContext(ctx, "batch operation failed", slog.Int("index", i), sl.Err(err))
+			results[i].Err = err
+			continue
+		}
+
+		if op.Type == BatchCreate {
+			results[i].ID = user.ID()
+			created = append(created, user)
+		}
+	}
+
+	if err = unit.Save(); err != nil {
+		log.ErrorContext(ctx, "could not save batch", sl.Err(err))
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if op.Type != BatchCreate && results[i].Err == nil {
+			if err = useCase.jsonCache.Del(ctx, op.ID.String()); err != nil {
+				log.ErrorContext(ctx, "failed to invalidate cached user", sl.Err(err))
+			}
+		}
+	}
+
+	for _, user := range created {
+		if err = useCase.publishCreated(ctx, user); err != nil {
+			log.ErrorContext(ctx, "failed to publish user created event", sl.Err(err))
+		}
+	}
+
+	log.InfoContext(ctx, "ran batch")
+	return results, nil
+}
+
+func (useCase *userUseCaseImpl) batchAtomic(
+	ctx context.Context,
+	log *slog.Logger,
+	ops []BatchOperationDTO) ([]BatchResultDTO, error) {
+	unit, err := useCase.ufw.StartWork(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "could not run batch", sl.Err(err))
+		return nil, err
+	}
+	defer unit.Cancel()
+
+	results := make([]BatchResultDTO, len(ops))
+	created := make([]*domain.User, 0, len(ops))
+	for i, op := range ops {
+		var user *domain.User
+		if user, err = useCase.batchOperation(ctx, unit, op); err != nil {
+			log.InfoContext(ctx, "batch operation failed", slog.Int("index", i), sl.Err(err))
+
+			results[i].Err = err
+			for j := range results {
+				if j != i {
+					results[j] = BatchResultDTO{Err: ErrBatchOperationSkipped}
+				}
+			}
+
+			return results, ErrBatchFailed
+		}
+
+		if op.Type == BatchCreate {
+			results[i].ID = user.ID()
+			created = append(created, user)
+		}
+	}
+
+	if err = unit.Save(); err != nil {
+		log.ErrorContext(ctx, "could not save batch", sl.Err(err))
+		return nil, err
+	}
+
+	for _, op := range ops {
+		if op.Type != BatchCreate {
+			if err = useCase.jsonCache.Del(ctx, op.ID.String()); err != nil {
+				log.ErrorContext(ctx, "failed to invalidate cached user", sl.Err(err))
+			}
+		}
+	}
+
+	for _, user := range created {
+		if err = useCase.publishCreated(ctx, user); err != nil {
+			log.ErrorContext(ctx, "failed to publish user created event", sl.Err(err))
+		}
+	}
+
+	log.InfoContext(ctx, "ran batch")
+	return results, nil
+}
+
+func (useCase *userUseCaseImpl) batchOperation(ctx context.Context, unit UnitOfWork, op BatchOperationDTO) (*domain.User, error) {
+	switch op.Type {
+	case BatchCreate:
+		user := domain.CreateUser(op.Create.Name, op.Create.Email)
+		if err := user.Validate(); err != nil {
+			return nil, err
+		}
+
+		return user, unit.Users().Insert(ctx, user)
+	case BatchUpdate:
+		user, err := unit.Users().GetByID(ctx, op.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		user.UpdatePartial(op.Update.Name, op.Update.Email)
+		return user, user.Validate()
+	case BatchDelete:
+		user, err := unit.Users().GetByID(ctx, op.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		return user, unit.Users().Remove(ctx, user)
+	default:
+		return nil, ErrUnknownBatchOperation
+	}
+}
+
+func (useCase *userUseCaseImpl) Export(ctx context.Context, fn func(*UserDTO) error) error {
+	log := useCase.log.With(sl.Op("Export"))
+	log.DebugContext(ctx, "exporting users")
+
+	unit, err := useCase.ufw.StartReadWork(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "could not export users", sl.Err(err))
+		return err
+	}
+	defer unit.Cancel()
+
+	var count int
+	err = unit.Users().ForEach(ctx, func(user *domain.User) error {
+		count++
+		return fn(userToDTO(user))
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "could not export users", slog.Int("exported", count), sl.Err(err))
+		return err
+	}
+
+	if err = unit.Save(); err != nil {
+		log.ErrorContext(ctx, "could not export users", sl.Err(err))
+		return err
+	}
+
+	log.InfoContext(ctx, "exported users", slog.Int("exported", count))
+	return nil
+}
+
+func (useCase *userUseCaseImpl) Reindex(ctx context.Context) (int, error) {
+	log := useCase.log.With(sl.Op("Reindex"))
+	log.DebugContext(ctx, "reindexing users")
+
+	unit, err := useCase.ufw.StartReadWork(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "could not reindex users", sl.Err(err))
+		return 0, err
+	}
+	defer unit.Cancel()
+
+	var count int
+	err = unit.Users().ForEach(ctx, func(user *domain.User) error {
+		if err := useCase.jsonCache.Set(ctx, user.ID().String(), userToDTO(user)); err != nil {
+			return err
+		}
+
+		count++
+		return nil
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "could not reindex users", slog.Int("reindexed", count), sl.Err(err))
+		return count, err
+	}
+
+	if err = unit.Save(); err != nil {
+		log.ErrorContext(ctx, "could not reindex users", sl.Err(err))
+		return count, err
+	}
+
+	log.InfoContext(ctx, "reindexed users", slog.Int("reindexed", count))
+	return count, nil
+}
+
+func (useCase *userUseCaseImpl) Import(
+	ctx context.Context,
+	records iter.Seq[ImportUserRecord],
+	batchSize int) (*ImportResultDTO, error) {
+	log := useCase.log.With(sl.Op("Import"))
+	log.DebugContext(ctx, "importing users")
+
+	res := &ImportResultDTO{}
+	lines := make([]int, 0, batchSize)
+	batch := make([]*domain.User, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		errs, err := useCase.insertBatch(ctx, batch)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+
+			// nothing of the batch is saved
+			log.InfoContext(ctx, "could not import batch", slog.Int("first_line", lines[0]), sl.Err(err))
+			for _, line := range lines {
+				res.Errors = append(res.Errors, ImportErrorDTO{line, err})
+			}
+		} else {
+			for i, err := range errs {
+				if err != nil {
+					res.Errors = append(res.Errors, ImportErrorDTO{lines[i], err})
+					continue
+				}
+
+				res.Imported++
+			}
+		}
+
+		lines, batch = lines[:0], batch[:0]
+		return nil
+	}
+
+	for rec := range records {
+		if rec.Err != nil {
+			res.Errors = append(res.Errors, ImportErrorDTO{rec.Line, rec.Err})
+			continue
+		}
+
+		user := importDtoToUser(rec.User)
+		if err := user.Validate(); err != nil {
+			res.Errors = append(res.Errors, ImportErrorDTO{rec.Line, err})
+			continue
+		}
+
+		lines, batch = append(lines, rec.Line), append(batch, user)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				log.ErrorContext(ctx, "could not import users", sl.Err(err))
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		log.ErrorContext(ctx, "could not import users", sl.Err(err))
+		return nil, err
+	}
+
+	log.InfoContext(ctx, "imported users",
+		slog.Int("imported", res.Imported),
+		slog.Int("failed", len(res.Errors)))
+	return res, nil
+}
+
+// insertBatch inserts every user under its own savepoint of a single unit of work,
+// so a failed user e.g. with a duplicate email does not roll back the others.
+// It returns the errors of the users and the error of the whole batch
+func (useCase *userUseCaseImpl) insertBatch(ctx context.Context, users []*domain.User) ([]error, error) {
+	unit, err := useCase.ufw.StartWork(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unit.Cancel()
+
+	errs := make([]error, len(users))
+	for i, user := range users {
+		errs[i] = unit.Savepoint(func() error {
+			return unit.Users().Insert(ctx, user)
+		})
+	}
+
+	if err = unit.Save(); err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
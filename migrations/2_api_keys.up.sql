@@ -0,0 +1,11 @@
+CREATE TABLE api_keys
+(
+    id           uuid PRIMARY KEY,
+    created_at   TIMESTAMP    NOT NULL,
+    name         VARCHAR(255) NOT NULL,
+    key_hash     CHAR(64)     NOT NULL UNIQUE,
+    scopes       VARCHAR(1024) NOT NULL,
+    expires_at   TIMESTAMP,
+    revoked_at   TIMESTAMP,
+    last_used_at TIMESTAMP
+);
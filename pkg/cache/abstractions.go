@@ -2,15 +2,19 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrMiss is returned by Get when there is no value for the key
+var ErrMiss = errors.New("cache miss")
+
 // JsonCache is a cache with the JSON serialization
 type JsonCache interface {
 	// Set serializes value to the JSON and sets the value for the given key with the given options
 	Set(ctx context.Context, key string, value any, opts ...Option) error
 
-	// Get returns the deserialized value for the given key
+	// Get returns the deserialized value for the given key or ErrMiss
 	Get(ctx context.Context, key string, target any) error
 
 	// Del deletes the value for the given key
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ExpiringJsonCache sets the default expiration to the values set without one,
+// the expiration can be changed at runtime and zero means no expiration
+type ExpiringJsonCache struct {
+	cache JsonCache
+	exp   atomic.Int64
+}
+
+var _ JsonCache = (*ExpiringJsonCache)(nil)
+
+func NewExpiringJsonCache(cache JsonCache, exp time.Duration) *ExpiringJsonCache {
+	ec := &ExpiringJsonCache{
+		cache: cache,
+	}
+	ec.SetExpiration(exp)
+
+	return ec
+}
+
+// SetExpiration changes the default expiration of the values set afterward
+func (cache *ExpiringJsonCache) SetExpiration(exp time.Duration) {
+	cache.exp.Store(int64(exp))
+}
+
+func (cache *ExpiringJsonCache) Set(ctx context.Context, key string, value any, opts ...Option) error {
+	// the options are applied in order, so the explicit expiration overrides the default one
+	opts = append([]Option{WithExpiration(time.Duration(cache.exp.Load()))}, opts...)
+	return cache.cache.Set(ctx, key, value, opts...)
+}
+
+func (cache *ExpiringJsonCache) Get(ctx context.Context, key string, target any) error {
+	return cache.cache.Get(ctx, key, target)
+}
+
+func (cache *ExpiringJsonCache) Del(ctx context.Context, key string) error {
+	return cache.cache.Del(ctx, key)
+}
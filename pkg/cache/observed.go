@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"errors"
+)
+
+// Operation results reported to Observer
+const (
+	ResultHit   = "hit"
+	ResultMiss  = "miss"
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Observer observes the cache operations, op is one of get, set and del
+type Observer interface {
+	ObserveCache(op, result string)
+}
+
+// ObservedJsonCache reports the operations of the underlying cache to the observer
+type ObservedJsonCache struct {
+	cache JsonCache
+	obs   Observer
+}
+
+var _ JsonCache = (*ObservedJsonCache)(nil)
+
+func NewObservedJsonCache(cache JsonCache, obs Observer) *ObservedJsonCache {
+	return &ObservedJsonCache{
+		cache: cache,
+		obs:   obs,
+	}
+}
+
+func (cache *ObservedJsonCache) Set(ctx context.Context, key string, value any, opts ...Option) error {
+	err := cache.cache.Set(ctx, key, value, opts...)
+	cache.obs.ObserveCache("set", result(err))
+	return err
+}
+
+func (cache *ObservedJsonCache) Get(ctx context.Context, key string, target any) error {
+	err := cache.cache.Get(ctx, key, target)
+
+	switch {
+	case err == nil:
+		cache.obs.ObserveCache("get", ResultHit)
+	case errors.Is(err, ErrMiss):
+		cache.obs.ObserveCache("get", ResultMiss)
+	default:
+		cache.obs.ObserveCache("get", ResultError)
+	}
+
+	return err
+}
+
+func (cache *ObservedJsonCache) Del(ctx context.Context, key string) error {
+	err := cache.cache.Del(ctx, key)
+	cache.obs.ObserveCache("del", result(err))
+	return err
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+
+	return ResultOK
+}
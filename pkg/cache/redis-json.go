@@ -3,15 +3,16 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/redis/go-redis/v9"
 	"time"
 )
 
 type RedisJsonCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
-func NewRedisJsonCache(client *redis.Client) (*RedisJsonCache, error) {
+func NewRedisJsonCache(client redis.UniversalClient) (*RedisJsonCache, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
@@ -41,6 +42,10 @@ func (cache *RedisJsonCache) Set(ctx context.Context, key string, value any, opt
 func (cache *RedisJsonCache) Get(ctx context.Context, key string, target any) error {
 	valueJson, err := cache.client.Get(ctx, key).Bytes()
 	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrMiss
+		}
+
 		return err
 	}
 
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/akimsavvin/test_go/pkg/cache")
+
+// TracedJsonCache starts a client span for every operation of the underlying cache
+type TracedJsonCache struct {
+	cache JsonCache
+}
+
+var _ JsonCache = (*TracedJsonCache)(nil)
+
+func NewTracedJsonCache(cache JsonCache) *TracedJsonCache {
+	return &TracedJsonCache{
+		cache: cache,
+	}
+}
+
+func (cache *TracedJsonCache) Set(ctx context.Context, key string, value any, opts ...Option) error {
+	ctx, span := startSpan(ctx, "set")
+	defer span.End()
+
+	err := cache.cache.Set(ctx, key, value, opts...)
+	recordError(span, err)
+	return err
+}
+
+func (cache *TracedJsonCache) Get(ctx context.Context, key string, target any) error {
+	ctx, span := startSpan(ctx, "get")
+	defer span.End()
+
+	err := cache.cache.Get(ctx, key, target)
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	if !errors.Is(err, ErrMiss) {
+		recordError(span, err)
+	}
+
+	return err
+}
+
+func (cache *TracedJsonCache) Del(ctx context.Context, key string) error {
+	ctx, span := startSpan(ctx, "del")
+	defer span.End()
+
+	err := cache.cache.Del(ctx, key)
+	recordError(span, err)
+	return err
+}
+
+func startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "cache "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("cache.operation", op)),
+	)
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -1,17 +1,33 @@
 package changetracker
 
-import "reflect"
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
 
+var (
+	ErrEntityNotRegistered  = errors.New("entity is not registered in change tracker")
+	ErrEntityAlreadyTracked = errors.New("entity is already tracked in change tracker")
+)
+
+// collection is the type-independent part of EntityCollection
+type collection interface {
+	Reset()
+}
+
+// ChangeTracker tracks the entities of the registered types, it is safe for concurrent use
 type ChangeTracker struct {
+	mu sync.RWMutex
 	// entities are map[reflect.Type]*EntityCollection[T]
-	entities map[reflect.Type]any
+	entities map[reflect.Type]collection
 }
 
 type Option func(ct *ChangeTracker)
 
 func New(opts ...Option) *ChangeTracker {
 	ct := &ChangeTracker{
-		entities: make(map[reflect.Type]any),
+		entities: make(map[reflect.Type]collection),
 	}
 
 	for _, opt := range opts {
@@ -23,42 +39,119 @@ func New(opts ...Option) *ChangeTracker {
 
 func WithEntity[T any](
 	getKeyFunc GetEntityKeyFunc[T],
-	hasChangedFunc HasEntityChangedFunc[T],
+	diffFunc DiffEntityFunc[T],
 	copyFunc ...CopyEntityFunc[T]) Option {
 	return func(ct *ChangeTracker) {
 		typ := reflect.TypeFor[T]()
-		coll := NewEntityCollection(getKeyFunc, hasChangedFunc, copyFunc...)
+		coll := NewEntityCollection(getKeyFunc, diffFunc, copyFunc...)
 
+		ct.mu.Lock()
 		ct.entities[typ] = coll
+		ct.mu.Unlock()
+	}
+}
+
+// WithBeforeSave registers the hook called for every pending entity of type T before its changes are flushed,
+// the entity type must be registered with WithEntity first
+func WithBeforeSave[T any](hook BeforeSaveHook[T]) Option {
+	return func(ct *ChangeTracker) {
+		Entity[T](ct).OnBeforeSave(hook)
+	}
+}
+
+// WithAfterSave registers the hook called for every saved entity of type T after the changes are accepted,
+// the entity type must be registered with WithEntity first
+func WithAfterSave[T any](hook AfterSaveHook[T]) Option {
+	return func(ct *ChangeTracker) {
+		Entity[T](ct).OnAfterSave(hook)
+	}
+}
+
+// Reset stops tracking all the entities
+func (ct *ChangeTracker) Reset() {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	for _, coll := range ct.entities {
+		coll.Reset()
+	}
+}
+
+// EntityState is the state of a tracked entity
+type EntityState int
+
+const (
+	// Detached means the entity is not tracked
+	Detached EntityState = iota
+	// Unchanged means the entity has not been changed since it was loaded
+	Unchanged
+	// Added means the entity is new and has to be inserted
+	Added
+	// Modified means the entity has been changed since it was loaded
+	Modified
+	// Deleted means the entity has to be deleted
+	Deleted
+)
+
+func (state EntityState) String() string {
+	switch state {
+	case Unchanged:
+		return "unchanged"
+	case Added:
+		return "added"
+	case Modified:
+		return "modified"
+	case Deleted:
+		return "deleted"
+	default:
+		return "detached"
 	}
 }
 
 type entity[T any] struct {
 	initial *T
 	current *T
+	state   EntityState
 }
 
 type GetEntityKeyFunc[T any] func(*T) any
 
-type HasEntityChangedFunc[T any] func(*T, *T) bool
-
 type CopyEntityFunc[T any] func(*T) *T
 
+// BeforeSaveHook is called for a pending entity before its changes are flushed,
+// returning an error aborts the save
+type BeforeSaveHook[T any] func(e *T, state EntityState) error
+
+// AfterSaveHook is called for a saved entity with the state it has been saved in
+type AfterSaveHook[T any] func(e *T, state EntityState)
+
+// EntityChanges is a changed entity with its field-level diff
+type EntityChanges[T any] struct {
+	Entity *T
+	Fields []FieldChange
+}
+
+// EntityCollection tracks the entities of type T, it is safe for concurrent use
 type EntityCollection[T any] struct {
-	entities       map[any]*entity[T]
-	getKeyFunc     GetEntityKeyFunc[T]
-	hasChangedFunc HasEntityChangedFunc[T]
-	copyFunc       CopyEntityFunc[T]
+	mu          sync.RWMutex
+	entities    map[any]*entity[T]
+	getKeyFunc  GetEntityKeyFunc[T]
+	diffFunc    DiffEntityFunc[T]
+	copyFunc    CopyEntityFunc[T]
+	beforeSaves []BeforeSaveHook[T]
+	afterSaves  []AfterSaveHook[T]
 }
 
+var _ collection = (*EntityCollection[any])(nil)
+
 func NewEntityCollection[T any](
 	getKeyFunc GetEntityKeyFunc[T],
-	hasChangedFunc HasEntityChangedFunc[T],
+	diffFunc DiffEntityFunc[T],
 	copyFunc ...CopyEntityFunc[T]) *EntityCollection[T] {
 	coll := &EntityCollection[T]{
-		entities:       make(map[any]*entity[T]),
-		getKeyFunc:     getKeyFunc,
-		hasChangedFunc: hasChangedFunc,
+		entities:   make(map[any]*entity[T]),
+		getKeyFunc: getKeyFunc,
+		diffFunc:   diffFunc,
 	}
 
 	if len(copyFunc) > 0 {
@@ -74,22 +167,164 @@ func NewEntityCollection[T any](
 	return coll
 }
 
-func (coll *EntityCollection[T]) Add(e *T) {
+// OnBeforeSave registers the hook called before the changes are flushed
+func (coll *EntityCollection[T]) OnBeforeSave(hook BeforeSaveHook[T]) {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	coll.beforeSaves = append(coll.beforeSaves, hook)
+}
+
+// OnAfterSave registers the hook called after the changes are accepted
+func (coll *EntityCollection[T]) OnAfterSave(hook AfterSaveHook[T]) {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	coll.afterSaves = append(coll.afterSaves, hook)
+}
+
+// Track starts tracking the entity loaded from the storage as Unchanged.
+// If an entity with the same key is already tracked, the tracked instance is returned
+// and the loaded one is discarded, so the in-memory changes are preserved
+func (coll *EntityCollection[T]) Track(e *T) *T {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
 	key := coll.getKeyFunc(e)
+	if tracked, ok := coll.entities[key]; ok {
+		return tracked.current
+	}
+
 	initial := coll.copyFunc(e)
-	coll.entities[key] = &entity[T]{initial, e}
+	coll.entities[key] = &entity[T]{initial, e, Unchanged}
+	return e
+}
+
+// Attach starts tracking the entity loaded elsewhere in the given state,
+// replacing the entity tracked with the same key.
+// An Unchanged entity is compared against its state at the moment of attaching,
+// a Modified one against its zero value, so all its non-zero fields are saved
+func (coll *EntityCollection[T]) Attach(e *T, state EntityState) {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	key := coll.getKeyFunc(e)
+	switch state {
+	case Detached:
+		delete(coll.entities, key)
+	case Added:
+		coll.entities[key] = &entity[T]{nil, e, Added}
+	case Modified:
+		coll.entities[key] = &entity[T]{new(T), e, Unchanged}
+	default:
+		coll.entities[key] = &entity[T]{coll.copyFunc(e), e, state}
+	}
+}
+
+// Detach stops tracking the entity
+func (coll *EntityCollection[T]) Detach(e *T) {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	delete(coll.entities, coll.getKeyFunc(e))
+}
+
+// Reset stops tracking all the entities
+func (coll *EntityCollection[T]) Reset() {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	clear(coll.entities)
+}
+
+// Find returns the tracked entity by its key
+func (coll *EntityCollection[T]) Find(key any) (*T, bool) {
+	coll.mu.RLock()
+	defer coll.mu.RUnlock()
+
+	tracked, ok := coll.entities[key]
+	if !ok {
+		return nil, false
+	}
+
+	return tracked.current, true
 }
 
+// Add starts tracking the new entity as Added,
+// it returns ErrEntityAlreadyTracked if an entity with the same key is tracked in another state
+func (coll *EntityCollection[T]) Add(e *T) error {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	key := coll.getKeyFunc(e)
+	if tracked, ok := coll.entities[key]; ok && tracked.state != Added {
+		return ErrEntityAlreadyTracked
+	}
+
+	coll.entities[key] = &entity[T]{nil, e, Added}
+	return nil
+}
+
+// Remove marks the entity as Deleted, an Added entity is just no longer tracked
 func (coll *EntityCollection[T]) Remove(e *T) {
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
 	key := coll.getKeyFunc(e)
-	delete(coll.entities, key)
+
+	tracked, ok := coll.entities[key]
+	if !ok {
+		coll.entities[key] = &entity[T]{coll.copyFunc(e), e, Deleted}
+		return
+	}
+
+	if tracked.state == Added {
+		delete(coll.entities, key)
+		return
+	}
+
+	tracked.state = Deleted
 }
 
-func (coll *EntityCollection[T]) Changed() []*T {
-	res := make([]*T, 0, len(coll.entities))
+// State returns the state of the entity
+func (coll *EntityCollection[T]) State(e *T) EntityState {
+	coll.mu.RLock()
+	defer coll.mu.RUnlock()
+
+	tracked, ok := coll.entities[coll.getKeyFunc(e)]
+	if !ok {
+		return Detached
+	}
+
+	return coll.stateOf(tracked)
+}
+
+func (coll *EntityCollection[T]) stateOf(e *entity[T]) EntityState {
+	if e.state == Unchanged && len(coll.diffFunc(e.initial, e.current)) > 0 {
+		return Modified
+	}
+
+	return e.state
+}
+
+// Added returns the entities to be inserted
+func (coll *EntityCollection[T]) Added() []*T {
+	return coll.inState(Added)
+}
+
+// Deleted returns the entities to be deleted
+func (coll *EntityCollection[T]) Deleted() []*T {
+	return coll.inState(Deleted)
+}
+
+func (coll *EntityCollection[T]) inState(state EntityState) []*T {
+	coll.mu.RLock()
+	defer coll.mu.RUnlock()
+
+	var res []*T
 
 	for _, e := range coll.entities {
-		if coll.hasChangedFunc(e.initial, e.current) {
+		if e.state == state {
 			res = append(res, e.current)
 		}
 	}
@@ -97,11 +332,127 @@ func (coll *EntityCollection[T]) Changed() []*T {
 	return res
 }
 
-func Entity[T any](ct *ChangeTracker) *EntityCollection[T] {
+func (coll *EntityCollection[T]) Changed() []*T {
+	changes := coll.Changes()
+	res := make([]*T, 0, len(changes))
+
+	for _, ch := range changes {
+		res = append(res, ch.Entity)
+	}
+
+	return res
+}
+
+// Changes returns the modified entities with their field-level diffs
+func (coll *EntityCollection[T]) Changes() []EntityChanges[T] {
+	coll.mu.RLock()
+	defer coll.mu.RUnlock()
+
+	res := make([]EntityChanges[T], 0, len(coll.entities))
+
+	for _, e := range coll.entities {
+		if e.state != Unchanged {
+			continue
+		}
+
+		if fields := coll.diffFunc(e.initial, e.current); len(fields) > 0 {
+			res = append(res, EntityChanges[T]{e.current, fields})
+		}
+	}
+
+	return res
+}
+
+type pendingEntity[T any] struct {
+	entity *T
+	state  EntityState
+}
+
+// pending returns the entities that are not Unchanged with their states
+func (coll *EntityCollection[T]) pending() []pendingEntity[T] {
+	coll.mu.RLock()
+	defer coll.mu.RUnlock()
+
+	return coll.pendingLocked()
+}
+
+// pendingLocked is pending for the caller holding the lock
+func (coll *EntityCollection[T]) pendingLocked() []pendingEntity[T] {
+	var res []pendingEntity[T]
+	for _, e := range coll.entities {
+		if state := coll.stateOf(e); state != Unchanged {
+			res = append(res, pendingEntity[T]{e.current, state})
+		}
+	}
+
+	return res
+}
+
+// BeforeSave calls the before save hooks for every pending entity
+func (coll *EntityCollection[T]) BeforeSave() error {
+	coll.mu.RLock()
+	hooks := coll.beforeSaves
+	coll.mu.RUnlock()
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	for _, p := range coll.pending() {
+		for _, hook := range hooks {
+			if err := hook(p.entity, p.state); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AcceptChanges marks all the entities as Unchanged after the changes have been flushed
+// and calls the after save hooks, the Deleted entities are no longer tracked
+func (coll *EntityCollection[T]) AcceptChanges() {
+	coll.mu.Lock()
+	// the pending entities are taken under the same lock, so none is accepted without the hooks
+	pending := coll.pendingLocked()
+	for key, e := range coll.entities {
+		if e.state == Deleted {
+			delete(coll.entities, key)
+			continue
+		}
+
+		e.initial = coll.copyFunc(e.current)
+		e.state = Unchanged
+	}
+	hooks := coll.afterSaves
+	coll.mu.Unlock()
+
+	for _, p := range pending {
+		for _, hook := range hooks {
+			hook(p.entity, p.state)
+		}
+	}
+}
+
+// EntityOf returns the entity collection of type T
+func EntityOf[T any](ct *ChangeTracker) (*EntityCollection[T], error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
 	coll, ok := ct.entities[reflect.TypeFor[T]()]
 	if !ok {
+		return nil, ErrEntityNotRegistered
+	}
+
+	return coll.(*EntityCollection[T]), nil
+}
+
+// Entity returns the entity collection of type T and panics if it is not registered
+func Entity[T any](ct *ChangeTracker) *EntityCollection[T] {
+	coll, err := EntityOf[T](ct)
+	if err != nil {
 		panic("ChangeTracker: no entity collection found in change tracker")
 	}
 
-	return coll.(*EntityCollection[T])
+	return coll
 }
@@ -0,0 +1,364 @@
+package changetracker_test
+
+import (
+	"errors"
+	"github.com/akimsavvin/test_go/pkg/changetracker"
+	"slices"
+	"sync"
+	"testing"
+)
+
+type item struct {
+	ID   int
+	Name string
+}
+
+func newTracker(opts ...changetracker.Option) *changetracker.ChangeTracker {
+	return changetracker.New(append([]changetracker.Option{
+		changetracker.WithEntity(
+			func(i *item) any { return i.ID },
+			changetracker.ReflectDiff[item](),
+		),
+	}, opts...)...)
+}
+
+func TestStates(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, coll *changetracker.EntityCollection[item]) *item
+		state changetracker.EntityState
+	}{
+		{
+			name: "not tracked",
+			setup: func(*testing.T, *changetracker.EntityCollection[item]) *item {
+				return &item{ID: 1}
+			},
+			state: changetracker.Detached,
+		},
+		{
+			name: "tracked",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				return coll.Track(&item{ID: 1, Name: "a"})
+			},
+			state: changetracker.Unchanged,
+		},
+		{
+			name: "tracked and changed",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := coll.Track(&item{ID: 1, Name: "a"})
+				i.Name = "b"
+				return i
+			},
+			state: changetracker.Modified,
+		},
+		{
+			name: "tracked and changed back",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := coll.Track(&item{ID: 1, Name: "a"})
+				i.Name = "b"
+				i.Name = "a"
+				return i
+			},
+			state: changetracker.Unchanged,
+		},
+		{
+			name: "added",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := &item{ID: 1}
+				mustAdd(t, coll, i)
+				return i
+			},
+			state: changetracker.Added,
+		},
+		{
+			name: "added and removed",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := &item{ID: 1}
+				mustAdd(t, coll, i)
+				coll.Remove(i)
+				return i
+			},
+			state: changetracker.Detached,
+		},
+		{
+			name: "tracked and removed",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := coll.Track(&item{ID: 1})
+				coll.Remove(i)
+				return i
+			},
+			state: changetracker.Deleted,
+		},
+		{
+			name: "removed without tracking",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := &item{ID: 1}
+				coll.Remove(i)
+				return i
+			},
+			state: changetracker.Deleted,
+		},
+		{
+			name: "attached unchanged",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := &item{ID: 1, Name: "a"}
+				coll.Attach(i, changetracker.Unchanged)
+				return i
+			},
+			state: changetracker.Unchanged,
+		},
+		{
+			name: "attached modified",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := &item{ID: 1, Name: "a"}
+				coll.Attach(i, changetracker.Modified)
+				return i
+			},
+			state: changetracker.Modified,
+		},
+		{
+			name: "attached added",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := &item{ID: 1}
+				coll.Attach(i, changetracker.Added)
+				return i
+			},
+			state: changetracker.Added,
+		},
+		{
+			name: "attached detached",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := coll.Track(&item{ID: 1})
+				coll.Attach(i, changetracker.Detached)
+				return i
+			},
+			state: changetracker.Detached,
+		},
+		{
+			name: "detached",
+			setup: func(t *testing.T, coll *changetracker.EntityCollection[item]) *item {
+				i := coll.Track(&item{ID: 1})
+				coll.Detach(i)
+				return i
+			},
+			state: changetracker.Detached,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coll := changetracker.Entity[item](newTracker())
+			i := tt.setup(t, coll)
+
+			if state := coll.State(i); state != tt.state {
+				t.Fatalf("expected state %s, got %s", tt.state, state)
+			}
+		})
+	}
+}
+
+func TestIdentityMap(t *testing.T) {
+	coll := changetracker.Entity[item](newTracker())
+
+	tracked := coll.Track(&item{ID: 1, Name: "a"})
+	tracked.Name = "b"
+
+	// the reloaded entity is discarded in favour of the tracked one with its changes
+	if reloaded := coll.Track(&item{ID: 1, Name: "a"}); reloaded != tracked {
+		t.Fatal("expected the tracked instance for the same key")
+	}
+
+	if found, ok := coll.Find(1); !ok || found != tracked {
+		t.Fatal("expected to find the tracked instance by its key")
+	}
+
+	if _, ok := coll.Find(2); ok {
+		t.Fatal("expected no entity for an unknown key")
+	}
+
+	if state := coll.State(tracked); state != changetracker.Modified {
+		t.Fatalf("expected the changes to be preserved, got state %s", state)
+	}
+}
+
+func TestAddAlreadyTracked(t *testing.T) {
+	coll := changetracker.Entity[item](newTracker())
+
+	coll.Track(&item{ID: 1})
+	if err := coll.Add(&item{ID: 1}); !errors.Is(err, changetracker.ErrEntityAlreadyTracked) {
+		t.Fatalf("expected %v, got %v", changetracker.ErrEntityAlreadyTracked, err)
+	}
+
+	mustAdd(t, coll, &item{ID: 2})
+	// an added entity can be replaced before it is saved
+	mustAdd(t, coll, &item{ID: 2, Name: "replaced"})
+
+	added := coll.Added()
+	if len(added) != 1 || added[0].Name != "replaced" {
+		t.Fatalf("expected the replaced entity to be added, got %v", added)
+	}
+}
+
+func TestReset(t *testing.T) {
+	ct := newTracker()
+	coll := changetracker.Entity[item](ct)
+
+	mustAdd(t, coll, &item{ID: 1})
+	tracked := coll.Track(&item{ID: 2})
+	tracked.Name = "changed"
+	coll.Remove(&item{ID: 3})
+
+	ct.Reset()
+
+	if len(coll.Added()) != 0 || len(coll.Changed()) != 0 || len(coll.Deleted()) != 0 {
+		t.Fatal("expected no pending entities after the reset")
+	}
+
+	if _, ok := coll.Find(2); ok {
+		t.Fatal("expected no tracked entities after the reset")
+	}
+}
+
+func TestChanges(t *testing.T) {
+	coll := changetracker.Entity[item](newTracker())
+
+	changed := coll.Track(&item{ID: 1, Name: "a"})
+	changed.Name = "b"
+	coll.Track(&item{ID: 2, Name: "a"})
+
+	changes := coll.Changes()
+	if len(changes) != 1 || changes[0].Entity != changed {
+		t.Fatalf("expected only the changed entity, got %v", changes)
+	}
+
+	fields := changes[0].Fields
+	if len(fields) != 1 || fields[0].Field != "Name" || fields[0].Old != "a" || fields[0].New != "b" {
+		t.Fatalf("expected the name change, got %v", fields)
+	}
+}
+
+type savedItem struct {
+	id    int
+	state changetracker.EntityState
+}
+
+func TestSaveHooks(t *testing.T) {
+	var before, after []savedItem
+	ct := newTracker(
+		changetracker.WithBeforeSave(func(i *item, state changetracker.EntityState) error {
+			before = append(before, savedItem{i.ID, state})
+			return nil
+		}),
+		changetracker.WithAfterSave(func(i *item, state changetracker.EntityState) {
+			after = append(after, savedItem{i.ID, state})
+		}),
+	)
+	coll := changetracker.Entity[item](ct)
+
+	mustAdd(t, coll, &item{ID: 1})
+	modified := coll.Track(&item{ID: 2, Name: "a"})
+	modified.Name = "b"
+	coll.Track(&item{ID: 3})
+	coll.Remove(coll.Track(&item{ID: 4}))
+
+	if err := coll.BeforeSave(); err != nil {
+		t.Fatal(err)
+	}
+	coll.AcceptChanges()
+
+	expected := []savedItem{
+		{1, changetracker.Added},
+		{2, changetracker.Modified},
+		{4, changetracker.Deleted},
+	}
+	for name, got := range map[string][]savedItem{"before": before, "after": after} {
+		slices.SortFunc(got, func(a, b savedItem) int { return a.id - b.id })
+		if !slices.Equal(got, expected) {
+			t.Errorf("%s save: expected %v, got %v", name, expected, got)
+		}
+	}
+
+	for id, state := range map[int]changetracker.EntityState{
+		1: changetracker.Unchanged,
+		2: changetracker.Unchanged,
+		3: changetracker.Unchanged,
+	} {
+		i, ok := coll.Find(id)
+		if !ok {
+			t.Fatalf("expected the entity %d to be tracked", id)
+		}
+
+		if got := coll.State(i); got != state {
+			t.Errorf("expected the entity %d to be %s, got %s", id, state, got)
+		}
+	}
+
+	if _, ok := coll.Find(4); ok {
+		t.Fatal("expected the deleted entity to be no longer tracked")
+	}
+}
+
+func TestBeforeSaveError(t *testing.T) {
+	errRejected := errors.New("rejected")
+	ct := newTracker(changetracker.WithBeforeSave(func(*item, changetracker.EntityState) error {
+		return errRejected
+	}))
+	coll := changetracker.Entity[item](ct)
+
+	// the hooks are not called without pending entities
+	coll.Track(&item{ID: 1})
+	if err := coll.BeforeSave(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mustAdd(t, coll, &item{ID: 2})
+	if err := coll.BeforeSave(); !errors.Is(err, errRejected) {
+		t.Fatalf("expected %v, got %v", errRejected, err)
+	}
+}
+
+// TestAcceptChangesConcurrent checks that every entity accepted as Unchanged has been passed to the after save hooks
+func TestAcceptChangesConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	saved := make(map[int]bool)
+	ct := newTracker(changetracker.WithAfterSave(func(i *item, _ changetracker.EntityState) {
+		mu.Lock()
+		saved[i.ID] = true
+		mu.Unlock()
+	}))
+	coll := changetracker.Entity[item](ct)
+
+	const n = 1000
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for id := range n {
+			if err := coll.Add(&item{ID: id}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range n {
+			coll.AcceptChanges()
+		}
+	}()
+	wg.Wait()
+	coll.AcceptChanges()
+
+	for id := range n {
+		if !saved[id] {
+			t.Fatalf("expected the entity %d to be saved", id)
+		}
+	}
+}
+
+func mustAdd(t *testing.T, coll *changetracker.EntityCollection[item], i *item) {
+	t.Helper()
+
+	if err := coll.Add(i); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,133 @@
+package changetracker
+
+import (
+	"reflect"
+)
+
+// FieldChange is a change of a single entity field
+type FieldChange struct {
+	Field string
+	Old   any
+	New   any
+}
+
+// DiffEntityFunc returns the changed fields between the initial and the current entity snapshots
+type DiffEntityFunc[T any] func(initial *T, current *T) []FieldChange
+
+// FieldAccessor reads and compares a single field of the entity
+type FieldAccessor[T any] struct {
+	name  string
+	value func(*T) any
+	equal func(*T, *T) bool
+}
+
+// Field returns an accessor for the field with the given name compared with the Equal method of V if any,
+// e.g. time.Time reloaded with another location or monotonic reading, and with == otherwise
+func Field[T any, V comparable](name string, get func(*T) V) FieldAccessor[T] {
+	return FieldFunc(name, get, func(a, b V) bool {
+		if eq, ok := any(a).(interface{ Equal(V) bool }); ok {
+			return eq.Equal(b)
+		}
+
+		return a == b
+	})
+}
+
+// FieldFunc returns an accessor for the field with the given name compared with the equal func
+func FieldFunc[T any, V any](name string, get func(*T) V, equal func(V, V) bool) FieldAccessor[T] {
+	return FieldAccessor[T]{
+		name: name,
+		value: func(e *T) any {
+			return get(e)
+		},
+		equal: func(initial *T, current *T) bool {
+			return equal(get(initial), get(current))
+		},
+	}
+}
+
+// AccessorDiff returns a DiffEntityFunc comparing the given fields,
+// suitable for entities with private fields exposed through getters
+func AccessorDiff[T any](fields ...FieldAccessor[T]) DiffEntityFunc[T] {
+	return func(initial *T, current *T) []FieldChange {
+		var changes []FieldChange
+
+		for _, field := range fields {
+			if !field.equal(initial, current) {
+				changes = append(changes, FieldChange{
+					Field: field.name,
+					Old:   field.value(initial),
+					New:   field.value(current),
+				})
+			}
+		}
+
+		return changes
+	}
+}
+
+// ReflectDiff returns a DiffEntityFunc comparing the exported fields of the struct T with their Equal method if any
+// and with reflect.DeepEqual otherwise. The field name is taken from the "db" tag if present,
+// unexported fields and fields tagged "db:\"-\"" are skipped
+func ReflectDiff[T any]() DiffEntityFunc[T] {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		panic("ChangeTracker: ReflectDiff requires a struct type")
+	}
+
+	type reflectField struct {
+		index int
+		name  string
+	}
+
+	var fields []reflectField
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("db"); ok {
+			if tag == "-" {
+				continue
+			}
+
+			name = tag
+		}
+
+		fields = append(fields, reflectField{i, name})
+	}
+
+	return func(initial *T, current *T) []FieldChange {
+		var changes []FieldChange
+
+		initialVal, currentVal := reflect.ValueOf(initial).Elem(), reflect.ValueOf(current).Elem()
+		for _, f := range fields {
+			oldField, newField := initialVal.Field(f.index), currentVal.Field(f.index)
+			oldVal, newVal := oldField.Interface(), newField.Interface()
+
+			if !reflectEqual(oldField, newField) {
+				changes = append(changes, FieldChange{
+					Field: f.name,
+					Old:   oldVal,
+					New:   newVal,
+				})
+			}
+		}
+
+		return changes
+	}
+}
+
+// reflectEqual compares the values with their Equal(T) bool method if any and with reflect.DeepEqual otherwise
+func reflectEqual(a, b reflect.Value) bool {
+	if m := a.MethodByName("Equal"); m.IsValid() {
+		mt := m.Type()
+		if mt.NumIn() == 1 && mt.In(0) == a.Type() && mt.NumOut() == 1 && mt.Out(0).Kind() == reflect.Bool {
+			return m.Call([]reflect.Value{b})[0].Bool()
+		}
+	}
+
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
@@ -0,0 +1,181 @@
+package changetracker_test
+
+import (
+	"database/sql"
+	"github.com/akimsavvin/test_go/pkg/changetracker"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string
+	Tags []string
+}
+
+type profile struct {
+	Name      string `db:"name"`
+	Email     string
+	CreatedAt time.Time `db:"created_at"`
+	DeletedAt sql.NullTime
+	Address   address
+	Internal  string `db:"-"`
+	secret    string
+}
+
+// instantLocal is the same instant as instant, but it is not == to it
+var (
+	instant      = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	instantLocal = instant.In(time.FixedZone("UTC+3", 3*60*60))
+)
+
+func baseProfile() profile {
+	return profile{
+		Name:      "John",
+		Email:     "john@example.com",
+		CreatedAt: instant,
+		Address:   address{City: "Berlin", Tags: []string{"home"}},
+	}
+}
+
+var profileAccessorDiff = changetracker.AccessorDiff(
+	changetracker.Field("name", func(p *profile) string { return p.Name }),
+	changetracker.Field("email", func(p *profile) string { return p.Email }),
+	changetracker.Field("created_at", func(p *profile) time.Time { return p.CreatedAt }),
+	changetracker.FieldFunc("deleted_at", func(p *profile) sql.NullTime { return p.DeletedAt },
+		func(a, b sql.NullTime) bool {
+			return a.Valid == b.Valid && (!a.Valid || a.Time.Equal(b.Time))
+		}),
+	changetracker.FieldFunc("address", func(p *profile) address { return p.Address },
+		func(a, b address) bool {
+			return reflect.DeepEqual(a, b)
+		}),
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *profile)
+		// accessor and reflect are the expected changed fields of the diffs
+		accessor []string
+		reflect  []string
+	}{
+		{
+			name:     "unchanged",
+			modify:   func(*profile) {},
+			accessor: nil,
+			reflect:  nil,
+		},
+		{
+			name: "changed",
+			modify: func(p *profile) {
+				p.Name = "Jane"
+				p.Email = "jane@example.com"
+			},
+			accessor: []string{"name", "email"},
+			reflect:  []string{"name", "Email"},
+		},
+		{
+			name: "equal time in another location",
+			modify: func(p *profile) {
+				p.CreatedAt = instantLocal
+			},
+		},
+		{
+			name: "changed time",
+			modify: func(p *profile) {
+				p.CreatedAt = instant.Add(time.Second)
+			},
+			accessor: []string{"created_at"},
+			reflect:  []string{"created_at"},
+		},
+		{
+			name: "set null time",
+			modify: func(p *profile) {
+				p.DeletedAt = sql.NullTime{Time: instant, Valid: true}
+			},
+			accessor: []string{"deleted_at"},
+			reflect:  []string{"DeletedAt"},
+		},
+		{
+			name: "changed nested field",
+			modify: func(p *profile) {
+				p.Address.City = "Paris"
+			},
+			accessor: []string{"address"},
+			reflect:  []string{"Address"},
+		},
+		{
+			name: "changed nested slice",
+			modify: func(p *profile) {
+				p.Address.Tags = []string{"work"}
+			},
+			accessor: []string{"address"},
+			reflect:  []string{"Address"},
+		},
+		{
+			name: "copied nested slice",
+			modify: func(p *profile) {
+				p.Address.Tags = []string{"home"}
+			},
+		},
+		{
+			name: "skipped fields",
+			modify: func(p *profile) {
+				p.Internal = "changed"
+				p.secret = "changed"
+			},
+		},
+	}
+
+	reflectDiff := changetracker.ReflectDiff[profile]()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initial, current := baseProfile(), baseProfile()
+			tt.modify(&current)
+
+			if got := changedFields(profileAccessorDiff(&initial, &current)); !slices.Equal(got, tt.accessor) {
+				t.Errorf("AccessorDiff: expected changed fields %v, got %v", tt.accessor, got)
+			}
+
+			if got := changedFields(reflectDiff(&initial, &current)); !slices.Equal(got, tt.reflect) {
+				t.Errorf("ReflectDiff: expected changed fields %v, got %v", tt.reflect, got)
+			}
+		})
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	initial, current := baseProfile(), baseProfile()
+	current.Name = "Jane"
+
+	changes := profileAccessorDiff(&initial, &current)
+	if len(changes) != 1 {
+		t.Fatalf("expected a single change, got %v", changes)
+	}
+
+	if changes[0].Old != "John" || changes[0].New != "Jane" {
+		t.Fatalf("expected the change from John to Jane, got %v to %v", changes[0].Old, changes[0].New)
+	}
+}
+
+func TestReflectDiffRequiresStruct(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic for a non-struct type")
+		}
+	}()
+
+	changetracker.ReflectDiff[string]()
+}
+
+func changedFields(changes []changetracker.FieldChange) []string {
+	var fields []string
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+
+	return fields
+}
@@ -0,0 +1,34 @@
+package feature
+
+import (
+	"maps"
+	"sync/atomic"
+)
+
+// Flags holds the feature toggles by their names, they can be changed at runtime
+type Flags struct {
+	flags atomic.Pointer[map[string]bool]
+}
+
+func NewFlags(flags map[string]bool) *Flags {
+	f := &Flags{}
+	f.Set(flags)
+
+	return f
+}
+
+// Enabled reports whether the feature is enabled, unknown features are disabled
+func (f *Flags) Enabled(name string) bool {
+	return (*f.flags.Load())[name]
+}
+
+// Set replaces all the toggles
+func (f *Flags) Set(flags map[string]bool) {
+	flags = maps.Clone(flags)
+	f.flags.Store(&flags)
+}
+
+// All returns a copy of the toggles
+func (f *Flags) All() map[string]bool {
+	return maps.Clone(*f.flags.Load())
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+)
+
+var ErrNoBrokers = errors.New("no kafka brokers configured")
+
+// DB checks the database connection
+func DB(db *sql.DB) Checker {
+	return CheckerFunc(db.PingContext)
+}
+
+// Redis checks the Redis connection
+func Redis(client redis.UniversalClient) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	})
+}
+
+// Kafka checks that any of the brokers is reachable through the dialer and knows the cluster controller,
+// nil dialer is kafka.DefaultDialer
+func Kafka(dialer *kafka.Dialer, brokers []string) Checker {
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	return CheckerFunc(func(ctx context.Context) error {
+		if len(brokers) == 0 {
+			return ErrNoBrokers
+		}
+
+		var errs []error
+		for _, broker := range brokers {
+			conn, err := dialer.DialContext(ctx, "tcp", broker)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if deadline, ok := ctx.Deadline(); ok {
+				_ = conn.SetDeadline(deadline)
+			}
+
+			_, err = conn.Controller()
+			_ = conn.Close()
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+
+		return errors.Join(errs...)
+	})
+}
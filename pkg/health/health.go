@@ -0,0 +1,204 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCheckTimeout = errors.New("health check timed out")
+
+// Status is the status of a check or of the whole registry
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Checker checks a dependency, nil error means it is healthy
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is a function Checker
+type CheckerFunc func(ctx context.Context) error
+
+func (fn CheckerFunc) Check(ctx context.Context) error {
+	return fn(ctx)
+}
+
+// CheckResult is the result of a single check
+type CheckResult struct {
+	Name      string        `json:"name"`
+	Status    Status        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration_ns"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Cached    bool          `json:"cached"`
+}
+
+// Report is the result of all the registry checks, it is up only if all of them are up
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type Option func(*checkOptions)
+
+type checkOptions struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+}
+
+// WithTimeout sets the time the check is considered down after
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *checkOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// WithCacheTTL sets the time the check result is reused for, so the probes do not overload the dependency
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(opts *checkOptions) {
+		opts.cacheTTL = ttl
+	}
+}
+
+type check struct {
+	name    string
+	checker Checker
+	opts    checkOptions
+
+	// mu is held while checking, so the concurrent probes wait for a single check
+	mu   sync.Mutex
+	last *CheckResult
+}
+
+// Registry runs the registered checks
+type Registry struct {
+	mu     sync.RWMutex
+	checks []*check
+	defs   checkOptions
+}
+
+// NewRegistry creates a Registry, the options are the defaults of the registered checks
+func NewRegistry(opts ...Option) *Registry {
+	defs := checkOptions{
+		timeout:  2 * time.Second,
+		cacheTTL: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&defs)
+	}
+
+	return &Registry{
+		defs: defs,
+	}
+}
+
+// Register adds the named check, the options override the registry defaults
+func (r *Registry) Register(name string, checker Checker, opts ...Option) {
+	chOpts := r.defs
+	for _, opt := range opts {
+		opt(&chOpts)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, &check{
+		name:    name,
+		checker: checker,
+		opts:    chOpts,
+	})
+}
+
+// Check runs all the checks concurrently
+func (r *Registry) Check(ctx context.Context) *Report {
+	r.mu.RLock()
+	checks := r.checks
+	r.mu.RUnlock()
+
+	report := &Report{
+		Status: StatusUp,
+		Checks: make([]CheckResult, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = ch.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, res := range report.Checks {
+		if res.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+func (ch *check) run(ctx context.Context) CheckResult {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.last != nil && time.Since(ch.last.CheckedAt) < ch.opts.cacheTTL {
+		res := *ch.last
+		res.Cached = true
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ch.opts.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ch.check(ctx)
+
+	res := CheckResult{
+		Name:      ch.name,
+		Status:    StatusUp,
+		Duration:  time.Since(start),
+		CheckedAt: start,
+	}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+
+	// a result of the cancelled probe says nothing about the dependency
+	if !errors.Is(err, context.Canceled) {
+		ch.last = &res
+	}
+
+	return res
+}
+
+// check runs the checker abandoning it on timeout, so a checker ignoring ctx does not block the probe
+func (ch *check) check(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- ch.checker.Check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrCheckTimeout
+		}
+
+		return err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrCheckTimeout
+		}
+
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,214 @@
+package jwtauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoKeys       = errors.New("no verification keys configured")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims are the claims of a verified token
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+	Scope string   `json:"scope,omitempty"`
+}
+
+// Scopes returns the space-delimited scope claim as a slice
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// key is a verification key with the algorithm it verifies
+type key struct {
+	alg string
+	key any
+}
+
+// Verifier verifies HS256, RS256 and EdDSA signed tokens
+type Verifier struct {
+	// keys are the keys with an identifier, matched by the "kid" header
+	keys map[string]key
+	// anonKeys are tried for tokens without a "kid" header
+	anonKeys []key
+
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+type Option func(v *Verifier) error
+
+func New(opts ...Option) (*Verifier, error) {
+	v := &Verifier{
+		keys: make(map[string]key),
+	}
+
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.keys) == 0 && len(v.anonKeys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	return v, nil
+}
+
+func (v *Verifier) addKey(kid string, k key) {
+	if kid == "" {
+		v.anonKeys = append(v.anonKeys, k)
+	} else {
+		v.keys[kid] = k
+	}
+}
+
+// WithHMACKey adds an HS256 secret, kid may be empty
+func WithHMACKey(kid string, secret []byte) Option {
+	return func(v *Verifier) error {
+		v.addKey(kid, key{jwt.SigningMethodHS256.Alg(), secret})
+		return nil
+	}
+}
+
+// WithRSAKey adds an RS256 public key, kid may be empty
+func WithRSAKey(kid string, pub *rsa.PublicKey) Option {
+	return func(v *Verifier) error {
+		v.addKey(kid, key{jwt.SigningMethodRS256.Alg(), pub})
+		return nil
+	}
+}
+
+// WithEd25519Key adds an EdDSA public key, kid may be empty
+func WithEd25519Key(kid string, pub ed25519.PublicKey) Option {
+	return func(v *Verifier) error {
+		v.addKey(kid, key{jwt.SigningMethodEdDSA.Alg(), pub})
+		return nil
+	}
+}
+
+// WithPEMKeyFile adds the RS256 or EdDSA public key from the PEM file
+func WithPEMKeyFile(kid string, path string) Option {
+	return func(v *Verifier) error {
+		pub, err := readPEMPublicKey(path)
+		if err != nil {
+			return err
+		}
+
+		switch pub := pub.(type) {
+		case *rsa.PublicKey:
+			return WithRSAKey(kid, pub)(v)
+		case ed25519.PublicKey:
+			return WithEd25519Key(kid, pub)(v)
+		default:
+			return fmt.Errorf("unsupported public key type %T in %s", pub, path)
+		}
+	}
+}
+
+// WithJWKSFile adds the keys of the local JWKS file
+func WithJWKSFile(path string) Option {
+	return func(v *Verifier) error {
+		keys, err := readJWKS(path)
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			v.addKey(k.kid, k.key)
+		}
+
+		return nil
+	}
+}
+
+// WithIssuer requires the "iss" claim to match
+func WithIssuer(iss string) Option {
+	return func(v *Verifier) error {
+		v.issuer = iss
+		return nil
+	}
+}
+
+// WithAudience requires the "aud" claim to contain the audience
+func WithAudience(aud string) Option {
+	return func(v *Verifier) error {
+		v.audience = aud
+		return nil
+	}
+}
+
+// WithLeeway allows the clock skew when validating the time claims
+func WithLeeway(leeway time.Duration) Option {
+	return func(v *Verifier) error {
+		v.leeway = leeway
+		return nil
+	}
+}
+
+// Verify verifies the token signature and claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodHS256.Alg(),
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodEdDSA.Alg(),
+		}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.leeway),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	claims := &Claims{}
+	if _, err := jwt.ParseWithClaims(token, claims, v.keyFunc, opts...); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// keyFunc returns only the keys of the token algorithm, so an RS256 public key is never used as an HS256 secret
+func (v *Verifier) keyFunc(token *jwt.Token) (any, error) {
+	alg := token.Method.Alg()
+
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		k, ok := v.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+
+		if k.alg != alg {
+			return nil, fmt.Errorf("key %q does not verify %s", kid, alg)
+		}
+
+		return k.key, nil
+	}
+
+	var set jwt.VerificationKeySet
+	for _, k := range v.anonKeys {
+		if k.alg == alg {
+			set.Keys = append(set.Keys, k.key)
+		}
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("no key verifies %s", alg)
+	}
+
+	return set, nil
+}
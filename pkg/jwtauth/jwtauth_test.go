@@ -0,0 +1,431 @@
+package jwtauth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/akimsavvin/test_go/pkg/jwtauth"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "lure"
+	testAudience = "lure-api"
+)
+
+var (
+	rsaKey       = mustRSAKey()
+	edPub, edKey = mustEd25519Key()
+	hmacKey      = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	return k
+}
+
+func mustEd25519Key() (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return pub, priv
+}
+
+func claims(mod func(c *jwtauth.Claims)) *jwtauth.Claims {
+	c := &jwtauth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	if mod != nil {
+		mod(c)
+	}
+
+	return c
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, c *jwtauth.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("could not sign token: %v", err)
+	}
+
+	return signed
+}
+
+// rsaPublicPEM is the RSA public key as an attacker would use it for an HS256 secret
+func rsaPublicPEM(t *testing.T) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	v, err := jwtauth.New(
+		jwtauth.WithRSAKey("", &rsaKey.PublicKey),
+		jwtauth.WithEd25519Key("ed", edPub),
+		jwtauth.WithIssuer(testIssuer),
+		jwtauth.WithAudience(testAudience),
+		jwtauth.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		valid bool
+	}{
+		{
+			name: "RS256",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(nil))
+			},
+			valid: true,
+		},
+		{
+			name: "EdDSA with kid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodEdDSA, "ed", edKey, claims(nil))
+			},
+			valid: true,
+		},
+		{
+			name: "HS256 signed with the RSA public key",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", rsaPublicPEM(t), claims(nil))
+			},
+		},
+		{
+			name: "HS256 signed with the Ed25519 public key of the kid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "ed", []byte(edPub), claims(nil))
+			},
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil))
+			},
+		},
+		{
+			name: "RS384 not allowed",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS384, "", rsaKey, claims(nil))
+			},
+		},
+		{
+			name: "signed by another key",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", mustRSAKey(), claims(nil))
+			},
+		},
+		{
+			name: "unknown kid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "other", rsaKey, claims(nil))
+			},
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(func(c *jwtauth.Claims) {
+					c.Audience = jwt.ClaimStrings{"other-api"}
+				}))
+			},
+		},
+		{
+			name: "no audience",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(func(c *jwtauth.Claims) {
+					c.Audience = nil
+				}))
+			},
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(func(c *jwtauth.Claims) {
+					c.Issuer = "other"
+				}))
+			},
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(func(c *jwtauth.Claims) {
+					c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				}))
+			},
+		},
+		{
+			name: "expired within leeway",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(func(c *jwtauth.Claims) {
+					c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+				}))
+			},
+			valid: true,
+		},
+		{
+			name: "no expiration",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(func(c *jwtauth.Claims) {
+					c.ExpiresAt = nil
+				}))
+			},
+		},
+		{
+			name: "not yet valid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(func(c *jwtauth.Claims) {
+					c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+				}))
+			},
+		},
+		{
+			name: "malformed",
+			token: func(*testing.T) string {
+				return "not.a.token"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := v.Verify(tt.token(t))
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("expected the token to be valid, got %v", err)
+				}
+				if c.Subject != "user" {
+					t.Fatalf("expected subject user, got %q", c.Subject)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, jwtauth.ErrInvalidToken) {
+				t.Fatalf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	v, err := jwtauth.New(jwtauth.WithHMACKey("", hmacKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = v.Verify(sign(t, jwt.SigningMethodHS256, "", hmacKey, claims(nil))); err != nil {
+		t.Fatalf("expected the HS256 token to be valid, got %v", err)
+	}
+
+	if _, err = v.Verify(sign(t, jwt.SigningMethodRS256, "", rsaKey, claims(nil))); !errors.Is(err, jwtauth.ErrInvalidToken) {
+		t.Fatalf("expected the RS256 token to be rejected by the HMAC only verifier, got %v", err)
+	}
+}
+
+func TestNewWithoutKeys(t *testing.T) {
+	if _, err := jwtauth.New(jwtauth.WithIssuer(testIssuer)); !errors.Is(err, jwtauth.ErrNoKeys) {
+		t.Fatalf("expected ErrNoKeys, got %v", err)
+	}
+}
+
+func TestWithPEMKeyFile(t *testing.T) {
+	pkcs1 := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey),
+	})
+
+	edDER, err := x509.MarshalPKIXPublicKey(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edDER})
+
+	tests := []struct {
+		name   string
+		pem    []byte
+		method jwt.SigningMethod
+		key    any
+	}{
+		{"RSA PKIX", rsaPublicPEM(t), jwt.SigningMethodRS256, rsaKey},
+		{"RSA PKCS1", pkcs1, jwt.SigningMethodRS256, rsaKey},
+		{"Ed25519 PKIX", edPEM, jwt.SigningMethodEdDSA, edKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := jwtauth.New(jwtauth.WithPEMKeyFile("", writeFile(t, "key.pem", tt.pem)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = v.Verify(sign(t, tt.method, "", tt.key, claims(nil))); err != nil {
+				t.Fatalf("expected the token to be valid, got %v", err)
+			}
+
+			// the public key must never be accepted as an HMAC secret
+			if _, err = v.Verify(sign(t, jwt.SigningMethodHS256, "", tt.pem, claims(nil))); !errors.Is(err, jwtauth.ErrInvalidToken) {
+				t.Fatalf("expected the HS256 token to be rejected, got %v", err)
+			}
+		})
+	}
+
+	t.Run("not PEM", func(t *testing.T) {
+		if _, err := jwtauth.New(jwtauth.WithPEMKeyFile("", writeFile(t, "key.pem", []byte("key")))); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestWithJWKSFile(t *testing.T) {
+	rsaJWK := map[string]string{
+		"kty": "RSA",
+		"kid": "rsa",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   b64(rsaKey.N.Bytes()),
+		"e":   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}
+	edJWK := map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)}
+	octJWK := map[string]string{"kty": "oct", "kid": "oct", "k": b64(hmacKey)}
+	encJWK := map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": "!", "e": "!"}
+
+	v, err := jwtauth.New(jwtauth.WithJWKSFile(writeJWKS(t, rsaJWK, edJWK, octJWK, encJWK)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		key    any
+		valid  bool
+	}{
+		{"RSA", jwt.SigningMethodRS256, "rsa", rsaKey, true},
+		{"Ed25519", jwt.SigningMethodEdDSA, "ed", edKey, true},
+		{"oct", jwt.SigningMethodHS256, "oct", hmacKey, true},
+		{"HS256 with the RSA kid", jwt.SigningMethodHS256, "rsa", rsaPublicPEM(t), false},
+		{"RS256 with the oct kid", jwt.SigningMethodRS256, "oct", rsaKey, false},
+		{"encryption key", jwt.SigningMethodRS256, "enc", rsaKey, false},
+		{"no kid", jwt.SigningMethodRS256, "", rsaKey, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(sign(t, tt.method, tt.kid, tt.key, claims(nil)))
+			if tt.valid && err != nil {
+				t.Fatalf("expected the token to be valid, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, jwtauth.ErrInvalidToken) {
+				t.Fatalf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name string
+		key  map[string]string
+	}{
+		{"unsupported key type", map[string]string{"kty": "EC", "kid": "ec"}},
+		{"unsupported curve", map[string]string{"kty": "OKP", "kid": "x", "crv": "X25519", "x": b64(edPub)}},
+		{"algorithm mismatch", map[string]string{"kty": "oct", "kid": "oct", "alg": "RS256", "k": b64(hmacKey)}},
+		{"short Ed25519 key", map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub[:16])}},
+		{"invalid base64", map[string]string{"kty": "RSA", "kid": "rsa", "n": "!", "e": "AQAB"}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwtauth.New(jwtauth.WithJWKSFile(writeJWKS(t, tt.key)))
+			if err == nil || !strings.Contains(err.Error(), "JWKS") {
+				t.Fatalf("expected a JWKS error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWithJWKSFileAnonymousKeys(t *testing.T) {
+	otherRSAKey := mustRSAKey()
+	rsaJWK := func(k *rsa.PrivateKey) map[string]string {
+		return map[string]string{
+			"kty": "RSA",
+			"n":   b64(k.N.Bytes()),
+			"e":   b64(big.NewInt(int64(k.E)).Bytes()),
+		}
+	}
+
+	v, err := jwtauth.New(jwtauth.WithJWKSFile(writeJWKS(t, rsaJWK(rsaKey), rsaJWK(otherRSAKey))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys without kid do not replace each other
+	for i, k := range []*rsa.PrivateKey{rsaKey, otherRSAKey} {
+		if _, err = v.Verify(sign(t, jwt.SigningMethodRS256, "", k, claims(nil))); err != nil {
+			t.Fatalf("expected the token of key %d to be valid, got %v", i, err)
+		}
+	}
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writeFile(t, "jwks.json", data)
+}
@@ -0,0 +1,134 @@
+package jwtauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+)
+
+func readPEMPublicKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// jwk is a single JSON Web Key of RSA, OKP or oct type
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	K   string `json:"k"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwksKey is a parsed key of a JWKS with its possibly empty identifier
+type jwksKey struct {
+	kid string
+	key key
+}
+
+// readJWKS returns the signature keys of the JWKS, the keys without identifier are all kept
+func readJWKS(path string) ([]jwksKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwks
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("could not parse JWKS %s: %w", path, err)
+	}
+
+	keys := make([]jwksKey, 0, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		parsed, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key %d of JWKS %s: %w", i, path, err)
+		}
+
+		if k.Alg != "" && k.Alg != parsed.alg {
+			return nil, fmt.Errorf("unsupported algorithm %q of key %d of JWKS %s", k.Alg, i, path)
+		}
+
+		keys = append(keys, jwksKey{k.Kid, parsed})
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) parse() (key, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return key{}, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return key{}, err
+		}
+
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return key{jwt.SigningMethodRS256.Alg(), pub}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return key{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return key{}, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return key{}, errors.New("invalid Ed25519 public key size")
+		}
+
+		return key{jwt.SigningMethodEdDSA.Alg(), ed25519.PublicKey(x)}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return key{}, err
+		}
+
+		return key{jwt.SigningMethodHS256.Alg(), secret}, nil
+	default:
+		return key{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,60 @@
+package otelkafka
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HeaderCarrier adapts the kafka message headers to propagation.TextMapCarrier
+type HeaderCarrier struct {
+	headers *[]kafka.Header
+}
+
+var _ propagation.TextMapCarrier = HeaderCarrier{}
+
+func NewHeaderCarrier(msg *kafka.Message) HeaderCarrier {
+	return HeaderCarrier{headers: &msg.Headers}
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+// Set replaces the header, so the re-published message does not carry the stale context
+func (c HeaderCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+
+	return keys
+}
+
+// Inject writes the context of ctx into the message headers with the global propagator
+func Inject(ctx context.Context, msg *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, NewHeaderCarrier(msg))
+}
+
+// Extract returns a copy of ctx carrying the context read from the message headers with the global propagator
+func Extract(ctx context.Context, msg *kafka.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, NewHeaderCarrier(msg))
+}
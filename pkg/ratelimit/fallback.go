@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultProbeInterval is how often a failed primary limiter is tried again
+const defaultProbeInterval = 5 * time.Second
+
+// FallbackLimiter uses the fallback limiter while the primary one fails,
+// e.g. the in-memory limiter while Redis is unavailable.
+// The failed primary is not called until the probe interval passes,
+// so an outage does not make every request wait for its timeout
+type FallbackLimiter struct {
+	log           *slog.Logger
+	primary       Limiter
+	fallback      Limiter
+	probeInterval time.Duration
+	now           func() time.Time
+
+	mu       sync.Mutex
+	degraded bool
+	probeAt  time.Time
+}
+
+var _ Limiter = (*FallbackLimiter)(nil)
+
+type FallbackOption func(l *FallbackLimiter)
+
+// WithProbeInterval sets how often the failed primary limiter is tried again
+func WithProbeInterval(interval time.Duration) FallbackOption {
+	return func(l *FallbackLimiter) {
+		l.probeInterval = interval
+	}
+}
+
+func NewFallbackLimiter(log *slog.Logger, primary, fallback Limiter, opts ...FallbackOption) *FallbackLimiter {
+	l := &FallbackLimiter{
+		log:           log,
+		primary:       primary,
+		fallback:      fallback,
+		probeInterval: defaultProbeInterval,
+		now:           time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if !l.usePrimary() {
+		return l.fallback.Allow(ctx, key, limit)
+	}
+
+	res, err := l.primary.Allow(ctx, key, limit)
+	if err == nil {
+		l.recovered(ctx)
+		return res, nil
+	}
+
+	if errors.Is(err, ErrInvalidLimit) {
+		return Result{}, err
+	}
+
+	l.failed(ctx, err)
+	return l.fallback.Allow(ctx, key, limit)
+}
+
+// usePrimary reports whether the primary limiter is to be called,
+// a single request probes the failed primary per interval
+func (l *FallbackLimiter) usePrimary() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.degraded {
+		return true
+	}
+
+	now := l.now()
+	if now.Before(l.probeAt) {
+		return false
+	}
+
+	l.probeAt = now.Add(l.probeInterval)
+	return true
+}
+
+// recovered switches back to the primary limiter, only the switch is logged
+func (l *FallbackLimiter) recovered(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.degraded {
+		l.degraded = false
+		l.log.InfoContext(ctx, "primary rate limiter recovered")
+	}
+}
+
+// failed switches to the fallback limiter until the next probe, only the switch is logged
+func (l *FallbackLimiter) failed(ctx context.Context, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.degraded {
+		l.degraded = true
+		l.log.WarnContext(ctx, "primary rate limiter failed, falling back", sl.Err(err))
+	}
+
+	l.probeAt = l.now().Add(l.probeInterval)
+}
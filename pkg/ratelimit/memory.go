@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often the full buckets are dropped
+const memorySweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+	fullAt time.Time
+}
+
+// MemoryLimiter is a Limiter keeping the buckets of a single instance in memory
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var _ Limiter = (*MemoryLimiter)(nil)
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	interval := float64(limit.interval())
+	burst := float64(limit.Burst)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, ts: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+float64(max(0, now.Sub(b.ts)))/interval)
+	b.ts = now
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) * interval))
+	}
+
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = time.Duration(math.Ceil((burst - b.tokens) * interval))
+	b.fullAt = now.Add(res.ResetAfter)
+
+	return res, nil
+}
+
+// sweep drops the buckets that are full again, they are equal to the missing ones
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < memorySweepInterval {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if !now.Before(b.fullAt) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
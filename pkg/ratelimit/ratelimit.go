@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("rate limit must have positive requests, period and burst")
+
+// Limit is a token bucket refilled by Requests tokens every Period holding at most Burst tokens
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// PerMinute returns a limit of n requests per minute with the burst of n
+func PerMinute(n int) Limit {
+	return Limit{Requests: n, Period: time.Minute, Burst: n}
+}
+
+// Validate reports whether the limit is usable
+func (l Limit) Validate() error {
+	if l.Requests <= 0 || l.Period <= 0 || l.Burst <= 0 {
+		return ErrInvalidLimit
+	}
+
+	return nil
+}
+
+// interval returns the time a single token is refilled in
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	// Allowed reports whether a token has been taken
+	Allowed bool
+
+	// Limit is the bucket capacity
+	Limit int
+
+	// Remaining is the number of whole tokens left
+	Remaining int
+
+	// RetryAfter is the time until the next token is available, zero if Allowed
+	RetryAfter time.Duration
+
+	// ResetAfter is the time until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Limiter takes tokens from the buckets identified by keys
+type Limiter interface {
+	// Allow takes a token from the bucket of key
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
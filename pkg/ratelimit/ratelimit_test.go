@@ -0,0 +1,246 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testLimit refills a token every 500ms and holds 3 tokens at most
+var testLimit = Limit{Requests: 2, Period: time.Second, Burst: 3}
+
+type step struct {
+	advance    time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+	resetAfter time.Duration
+}
+
+var tokenBucketSteps = []step{
+	{0, true, 2, 0, 500 * time.Millisecond},
+	{0, true, 1, 0, time.Second},
+	{0, true, 0, 0, 1500 * time.Millisecond},
+	{0, false, 0, 500 * time.Millisecond, 1500 * time.Millisecond},
+	{250 * time.Millisecond, false, 0, 250 * time.Millisecond, 1250 * time.Millisecond},
+	{250 * time.Millisecond, true, 0, 0, 1500 * time.Millisecond},
+	// the bucket is refilled up to the burst only
+	{10 * time.Second, true, 2, 0, 500 * time.Millisecond},
+}
+
+// clockedLimiter is a limiter with the clock advanced by the tests
+type clockedLimiter struct {
+	Limiter
+	advance func(d time.Duration)
+}
+
+func newTestMemoryLimiter() clockedLimiter {
+	l := NewMemoryLimiter()
+	now := testStart
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+
+	return clockedLimiter{l, func(d time.Duration) { now = now.Add(d) }}
+}
+
+func newTestRedisLimiter(t *testing.T) (clockedLimiter, *miniredis.Miniredis) {
+	t.Helper()
+
+	m := miniredis.RunT(t)
+	now := testStart
+	m.SetTime(now)
+
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return clockedLimiter{NewRedisLimiter(client, "rl:"), func(d time.Duration) {
+		now = now.Add(d)
+		m.SetTime(now)
+		m.FastForward(d)
+	}}, m
+}
+
+func TestTokenBucket(t *testing.T) {
+	limiters := map[string]func(t *testing.T) clockedLimiter{
+		"memory": func(*testing.T) clockedLimiter {
+			return newTestMemoryLimiter()
+		},
+		"redis": func(t *testing.T) clockedLimiter {
+			l, _ := newTestRedisLimiter(t)
+			return l
+		},
+	}
+
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			l := newLimiter(t)
+			ctx := context.Background()
+
+			for i, s := range tokenBucketSteps {
+				l.advance(s.advance)
+
+				res, err := l.Allow(ctx, "key", testLimit)
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+
+				expected := Result{
+					Allowed:    s.allowed,
+					Limit:      testLimit.Burst,
+					Remaining:  s.remaining,
+					RetryAfter: s.retryAfter,
+					ResetAfter: s.resetAfter,
+				}
+				if res != expected {
+					t.Fatalf("step %d: expected %+v, got %+v", i, expected, res)
+				}
+			}
+
+			// the buckets of the other keys are not affected
+			res, err := l.Allow(ctx, "other", testLimit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !res.Allowed || res.Remaining != testLimit.Burst-1 {
+				t.Fatalf("expected a full bucket of another key, got %+v", res)
+			}
+
+			if _, err = l.Allow(ctx, "key", Limit{Requests: 1, Period: time.Second}); !errors.Is(err, ErrInvalidLimit) {
+				t.Fatalf("expected %v, got %v", ErrInvalidLimit, err)
+			}
+		})
+	}
+}
+
+func TestRedisLimiterExpiry(t *testing.T) {
+	l, m := newTestRedisLimiter(t)
+
+	res, err := l.Allow(context.Background(), "key", testLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the bucket expires once it would be full again
+	if ttl := m.TTL("rl:key"); ttl != res.ResetAfter {
+		t.Fatalf("expected the bucket to expire in %s, got %s", res.ResetAfter, ttl)
+	}
+
+	l.advance(res.ResetAfter)
+	if m.Exists("rl:key") {
+		t.Fatal("expected the full bucket to expire")
+	}
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	l := newTestMemoryLimiter()
+	ctx := context.Background()
+
+	for _, key := range []string{"full", "empty"} {
+		if _, err := l.Allow(ctx, key, testLimit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the bucket of empty is not full again by the sweep
+	l.advance(memorySweepInterval - time.Second)
+	for range testLimit.Burst {
+		if _, err := l.Allow(ctx, "empty", Limit{Requests: 1, Period: time.Hour, Burst: testLimit.Burst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l.advance(time.Second)
+	if _, err := l.Allow(ctx, "another", testLimit); err != nil {
+		t.Fatal(err)
+	}
+
+	buckets := l.Limiter.(*MemoryLimiter).buckets
+	if _, ok := buckets["full"]; ok {
+		t.Fatal("expected the full bucket to be swept")
+	}
+
+	if _, ok := buckets["empty"]; !ok {
+		t.Fatal("expected the not full bucket to be kept")
+	}
+}
+
+// stubLimiter counts the calls and fails with its err
+type stubLimiter struct {
+	calls int
+	err   error
+}
+
+func (l *stubLimiter) Allow(context.Context, string, Limit) (Result, error) {
+	l.calls++
+	if l.err != nil {
+		return Result{}, l.err
+	}
+
+	return Result{Allowed: true}, nil
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	primary := &stubLimiter{err: errors.New("redis is down")}
+	fallback := &stubLimiter{}
+
+	l := NewFallbackLimiter(slog.New(slog.NewTextHandler(io.Discard, nil)), primary, fallback,
+		WithProbeInterval(time.Second))
+	now := testStart
+	l.now = func() time.Time { return now }
+
+	allow := func(primaryCalls, fallbackCalls int) {
+		t.Helper()
+
+		if _, err := l.Allow(context.Background(), "key", testLimit); err != nil {
+			t.Fatal(err)
+		}
+
+		if primary.calls != primaryCalls || fallback.calls != fallbackCalls {
+			t.Fatalf("expected %d primary and %d fallback calls, got %d and %d",
+				primaryCalls, fallbackCalls, primary.calls, fallback.calls)
+		}
+	}
+
+	// the failed primary is not called again until the probe interval passes
+	allow(1, 1)
+	allow(1, 2)
+	now = now.Add(999 * time.Millisecond)
+	allow(1, 3)
+
+	now = now.Add(time.Millisecond)
+	allow(2, 4)
+	allow(2, 5)
+
+	primary.err = nil
+	now = now.Add(time.Second)
+	allow(3, 5)
+	allow(4, 5)
+}
+
+func TestFallbackLimiterInvalidLimit(t *testing.T) {
+	primary := &stubLimiter{err: ErrInvalidLimit}
+	fallback := &stubLimiter{}
+	l := NewFallbackLimiter(slog.New(slog.NewTextHandler(io.Discard, nil)), primary, fallback)
+
+	// an invalid limit is not a primary failure
+	for range 2 {
+		if _, err := l.Allow(context.Background(), "key", testLimit); !errors.Is(err, ErrInvalidLimit) {
+			t.Fatalf("expected %v, got %v", ErrInvalidLimit, err)
+		}
+	}
+
+	if primary.calls != 2 || fallback.calls != 0 {
+		t.Fatalf("expected only the primary to be called, got %d primary and %d fallback calls",
+			primary.calls, fallback.calls)
+	}
+}
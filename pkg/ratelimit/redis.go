@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// tokenBucketScript refills and takes a token atomically using the Redis server clock,
+// so the limit is shared by all the instances regardless of their clock skew.
+// The bucket expires once it would be full again.
+var tokenBucketScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / interval)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * interval)
+end
+
+local reset = math.ceil((burst - tokens) * interval)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.max(1, math.ceil(reset / 1000)))
+
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// RedisLimiter is a Limiter sharing the buckets through Redis
+type RedisLimiter struct {
+	client redis.Scripter
+	prefix string
+}
+
+var _ Limiter = (*RedisLimiter)(nil)
+
+// NewRedisLimiter creates a RedisLimiter storing the buckets under the keys starting with prefix
+func NewRedisLimiter(client redis.Scripter, prefix string) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key},
+		limit.interval().Microseconds(), limit.Burst).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Limit:      limit.Burst,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Microsecond,
+		ResetAfter: time.Duration(res[3]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package sl
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+)
+
+// Headers the IDs are propagated in
+const (
+	HeaderRequestID     = "X-Request-ID"
+	HeaderCorrelationID = "X-Correlation-ID"
+	HeaderUserID        = "X-User-ID"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	correlationIDKey
+	userIDKey
+)
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID of ctx
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID shared by the requests of a single flow
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationID returns the correlation ID of ctx
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// WithUserID returns a copy of ctx carrying the ID of the acting user
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+// UserID returns the ID of the acting user of ctx
+func UserID(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey).(string)
+	return id
+}
+
+// Carrier reads and writes the propagated IDs, e.g. the message headers
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// InjectIDs writes the IDs of ctx into the carrier
+func InjectIDs(ctx context.Context, c Carrier) {
+	if id := RequestID(ctx); id != "" {
+		c.Set(HeaderRequestID, id)
+	}
+	if id := CorrelationID(ctx); id != "" {
+		c.Set(HeaderCorrelationID, id)
+	}
+	if id := UserID(ctx); id != "" {
+		c.Set(HeaderUserID, id)
+	}
+}
+
+// ExtractIDs returns a copy of ctx carrying the IDs read from the carrier
+func ExtractIDs(ctx context.Context, c Carrier) context.Context {
+	if id := c.Get(HeaderRequestID); id != "" {
+		ctx = WithRequestID(ctx, id)
+	}
+	if id := c.Get(HeaderCorrelationID); id != "" {
+		ctx = WithCorrelationID(ctx, id)
+	}
+	if id := c.Get(HeaderUserID); id != "" {
+		ctx = WithUserID(ctx, id)
+	}
+
+	return ctx
+}
+
+// ContextHandler adds the request, correlation, trace and user IDs of the context to every record
+type ContextHandler struct {
+	slog.Handler
+}
+
+var _ slog.Handler = (*ContextHandler)(nil)
+
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{
+		Handler: h,
+	}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := CorrelationID(ctx); id != "" {
+		r.AddAttrs(slog.String("correlation_id", id))
+	}
+	if id := UserID(ctx); id != "" {
+		r.AddAttrs(slog.String("user_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewContextHandler(h.Handler.WithAttrs(attrs))
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return NewContextHandler(h.Handler.WithGroup(name))
+}
@@ -0,0 +1,168 @@
+package sl
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Levels holds the default level and the per-module overrides, it can be changed at runtime.
+// A module is an operation set with Op or a group name of the logger.
+type Levels struct {
+	def     slog.LevelVar
+	mu      sync.RWMutex
+	modules map[string]slog.Level
+}
+
+func NewLevels(def slog.Level, modules map[string]slog.Level) *Levels {
+	l := &Levels{
+		modules: maps.Clone(modules),
+	}
+	if l.modules == nil {
+		l.modules = make(map[string]slog.Level)
+	}
+	l.def.Set(def)
+
+	return l
+}
+
+func (l *Levels) Default() slog.Level {
+	return l.def.Level()
+}
+
+func (l *Levels) SetDefault(level slog.Level) {
+	l.def.Set(level)
+}
+
+// Module returns the level override of the module
+func (l *Levels) Module(module string) (slog.Level, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	level, ok := l.modules[module]
+	return level, ok
+}
+
+func (l *Levels) SetModule(module string, level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.modules[module] = level
+}
+
+// ResetModule removes the level override of the module, so the default level applies to it
+func (l *Levels) ResetModule(module string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.modules, module)
+}
+
+// Modules returns a copy of the level overrides
+func (l *Levels) Modules() map[string]slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return maps.Clone(l.modules)
+}
+
+// level returns the level of the most specific module having an override, modules are ordered from the outermost
+func (l *Levels) level(modules []string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, module := range slices.Backward(modules) {
+		if level, ok := l.modules[module]; ok {
+			return level
+		}
+	}
+
+	return l.def.Level()
+}
+
+// min returns the lowest of the levels, the records below it are never logged
+func (l *Levels) min() slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	level := l.def.Level()
+	for _, ml := range l.modules {
+		level = min(level, ml)
+	}
+
+	return level
+}
+
+// LevelHandler filters the records by the Levels of their modules,
+// the wrapped handler must enable all the levels
+type LevelHandler struct {
+	next    slog.Handler
+	levels  *Levels
+	modules []string
+}
+
+var _ slog.Handler = (*LevelHandler)(nil)
+
+func NewLevelHandler(next slog.Handler, levels *Levels) *LevelHandler {
+	return &LevelHandler{
+		next:   next,
+		levels: levels,
+	}
+}
+
+// Enabled lets through the levels a module of the log call may enable, Handle filters them precisely
+func (h *LevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.levels.min() && h.next.Enabled(ctx, level)
+}
+
+func (h *LevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	// the operations passed to the log call itself are known only now
+	modules := h.modules
+	r.Attrs(func(a slog.Attr) bool {
+		if m := appendModules(nil, a); m != nil {
+			modules = append(slices.Clip(modules), m...)
+		}
+		return true
+	})
+
+	if r.Level < h.levels.level(modules) {
+		return nil
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	modules := slices.Clone(h.modules)
+	for _, a := range attrs {
+		modules = appendModules(modules, a)
+	}
+
+	return &LevelHandler{
+		next:    h.next.WithAttrs(attrs),
+		levels:  h.levels,
+		modules: modules,
+	}
+}
+
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{
+		next:    h.next.WithGroup(name),
+		levels:  h.levels,
+		modules: append(slices.Clone(h.modules), name),
+	}
+}
+
+// appendModules appends the operation or the group name the attribute defines
+func appendModules(modules []string, a slog.Attr) []string {
+	switch {
+	case a.Key == opKey:
+		return append(modules, a.Value.String())
+	case a.Value.Kind() == slog.KindGroup && a.Key != "":
+		return append(modules, a.Key)
+	default:
+		return modules
+	}
+}
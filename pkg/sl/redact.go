@@ -0,0 +1,186 @@
+package sl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// RedactMode is how the personal data is redacted
+type RedactMode int
+
+const (
+	// RedactMask replaces the values with a placeholder
+	RedactMask RedactMode = iota
+
+	// RedactHash replaces the values with their hashes, so they stay correlatable without being readable
+	RedactHash
+)
+
+const redactedValue = "[REDACTED]"
+
+var (
+	emailRegexp = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+	// phoneRegexp matches the international numbers and the (123) 456-7890 form only,
+	// so the identifiers and timestamps made of digits are not taken for phones
+	phoneRegexp = regexp.MustCompile(`\+\d{1,3}[\s.-]?(?:\(\d{1,4}\)[\s.-]?)?\d{2,4}(?:[\s.-]?\d{2,4}){1,4}|\(\d{3}\)\s?\d{3}-\d{4}`)
+)
+
+type RedactOption func(*RedactHandler)
+
+// WithRedactKeys redacts the whole values of the attributes with the keys, the keys are case-insensitive
+func WithRedactKeys(keys ...string) RedactOption {
+	return func(h *RedactHandler) {
+		for _, key := range keys {
+			h.keys[strings.ToLower(key)] = struct{}{}
+		}
+	}
+}
+
+// WithRedactMode sets the redaction mode, RedactMask is the default
+func WithRedactMode(mode RedactMode) RedactOption {
+	return func(h *RedactHandler) {
+		h.mode = mode
+	}
+}
+
+// WithHashKey keys the RedactHash hashes, so the short values like emails can not be brute-forced
+func WithHashKey(key []byte) RedactOption {
+	return func(h *RedactHandler) {
+		h.hashKey = key
+	}
+}
+
+// WithoutPatterns disables the email and phone detection in the values of the other attributes
+func WithoutPatterns() RedactOption {
+	return func(h *RedactHandler) {
+		h.patterns = nil
+	}
+}
+
+// RedactHandler redacts the configured attributes and the emails and phones found in the messages
+// and string values. The LogValuer values are resolved first, so the DTOs can expose their fields to it.
+type RedactHandler struct {
+	next     slog.Handler
+	keys     map[string]struct{}
+	mode     RedactMode
+	hashKey  []byte
+	patterns []*regexp.Regexp
+}
+
+var _ slog.Handler = (*RedactHandler)(nil)
+
+func NewRedactHandler(next slog.Handler, opts ...RedactOption) *RedactHandler {
+	h := &RedactHandler{
+		next:     next,
+		keys:     make(map[string]struct{}),
+		patterns: []*regexp.Regexp{emailRegexp, phoneRegexp},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	res := slog.NewRecord(r.Time, r.Level, h.redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		res.AddAttrs(h.redact(a))
+		return true
+	})
+
+	return h.next.Handle(ctx, res)
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redacted = append(redacted, h.redact(a))
+	}
+
+	clone := *h
+	clone.next = h.next.WithAttrs(redacted)
+	return &clone
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	return &clone
+}
+
+func (h *RedactHandler) redact(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	if _, ok := h.keys[strings.ToLower(a.Key)]; ok {
+		return slog.String(a.Key, h.replace(a.Value.String()))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		redacted := make([]slog.Attr, 0, len(attrs))
+		for _, ga := range attrs {
+			redacted = append(redacted, h.redact(ga))
+		}
+
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindString:
+		return slog.String(a.Key, h.redactString(a.Value.String()))
+	case slog.KindAny:
+		// errors and other values are checked by their text, they are kept as is if there is nothing to redact
+		if s := fmt.Sprint(a.Value.Any()); h.hasPattern(s) {
+			return slog.String(a.Key, h.redactString(s))
+		}
+	}
+
+	return a
+}
+
+func (h *RedactHandler) hasPattern(s string) bool {
+	for _, p := range h.patterns {
+		if p.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *RedactHandler) redactString(s string) string {
+	for _, p := range h.patterns {
+		s = p.ReplaceAllStringFunc(s, h.replace)
+	}
+
+	return s
+}
+
+func (h *RedactHandler) replace(s string) string {
+	if h.mode != RedactHash {
+		return redactedValue
+	}
+
+	var sum []byte
+	if h.hashKey != nil {
+		mac := hmac.New(sha256.New, h.hashKey)
+		mac.Write([]byte(s))
+		sum = mac.Sum(nil)
+	} else {
+		hash := sha256.Sum256([]byte(s))
+		sum = hash[:]
+	}
+
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
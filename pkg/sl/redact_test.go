@@ -0,0 +1,313 @@
+package sl_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/akimsavvin/test_go/internal/usecase"
+	"github.com/akimsavvin/test_go/pkg/sl"
+	"github.com/google/uuid"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// logRecord logs a single record through the redacting handler and returns it decoded from JSON
+func logRecord(t *testing.T, log func(l *slog.Logger), opts ...sl.RedactOption) map[string]any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	h := sl.NewRedactHandler(slog.NewJSONHandler(&buf, nil), opts...)
+	log(slog.New(h))
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("could not decode %q: %v", buf.String(), err)
+	}
+
+	return rec
+}
+
+// field returns the value of the record at the dotted path
+func field(rec map[string]any, path string) any {
+	var v any = rec
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+
+	return v
+}
+
+type user struct {
+	Name  string
+	Email string
+}
+
+func (u user) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("name", u.Name), slog.String("email", u.Email))
+}
+
+func TestRedactHandler(t *testing.T) {
+	keys := sl.WithRedactKeys("Email", "password")
+
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		// fields are the expected values of the record at the dotted paths
+		fields map[string]any
+	}{
+		{
+			name: "keyed attribute",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.String("password", "hunter2"), slog.Int("attempt", 3))
+			},
+			fields: map[string]any{"password": redacted, "attempt": float64(3)},
+		},
+		{
+			name: "case-insensitive key",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.String("EMAIL", "not an email"))
+			},
+			fields: map[string]any{"EMAIL": redacted},
+		},
+		{
+			name: "keyed non-string attribute",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.Int("password", 1234))
+			},
+			fields: map[string]any{"password": redacted},
+		},
+		{
+			name: "keyed attribute in group",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.Group("req", slog.String("password", "hunter2"), slog.String("path", "/login")))
+			},
+			fields: map[string]any{"req.password": redacted, "req.path": "/login"},
+		},
+		{
+			name: "keyed attribute after WithGroup",
+			log: func(l *slog.Logger) {
+				l.WithGroup("req").Info("msg", slog.String("password", "hunter2"))
+			},
+			fields: map[string]any{"req.password": redacted},
+		},
+		{
+			name: "keyed attribute of WithAttrs",
+			log: func(l *slog.Logger) {
+				l.With(slog.String("password", "hunter2"), slog.String("op", "Login")).Info("msg")
+			},
+			fields: map[string]any{"password": redacted, "op": "Login"},
+		},
+		{
+			name: "keyed group",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.Group("password", slog.String("old", "a"), slog.String("new", "b")))
+			},
+			fields: map[string]any{"password": redacted},
+		},
+		{
+			name: "LogValuer fields",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.Any("user", user{"John", "john@example.com"}))
+			},
+			fields: map[string]any{"user.name": "John", "user.email": redacted},
+		},
+		{
+			name: "LogValuer of WithAttrs",
+			log: func(l *slog.Logger) {
+				l.With(slog.Any("user", user{"John", "john@example.com"})).Info("msg")
+			},
+			fields: map[string]any{"user.email": redacted},
+		},
+		{
+			name: "email in message",
+			log: func(l *slog.Logger) {
+				l.Info("sent to john.doe+news@mail.example.com today")
+			},
+			fields: map[string]any{"msg": "sent to " + redacted + " today"},
+		},
+		{
+			name: "email in string",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.String("to", "John <john@example.com>"))
+			},
+			fields: map[string]any{"to": "John <" + redacted + ">"},
+		},
+		{
+			name: "international phone in message",
+			log: func(l *slog.Logger) {
+				l.Info("calling +1 555-123-4567 now")
+			},
+			fields: map[string]any{"msg": "calling " + redacted + " now"},
+		},
+		{
+			name: "international phone with area code",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.String("phone_number", "+44 (20) 7946 0958"))
+			},
+			fields: map[string]any{"phone_number": redacted},
+		},
+		{
+			name: "local phone",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.String("contact", "(555) 123-4567"))
+			},
+			fields: map[string]any{"contact": redacted},
+		},
+		{
+			name: "email in error",
+			log: func(l *slog.Logger) {
+				l.Error("msg", sl.Err(errors.New("user john@example.com already exists")))
+			},
+			fields: map[string]any{"error": "user " + redacted + " already exists"},
+		},
+		{
+			name: "email in error value",
+			log: func(l *slog.Logger) {
+				l.Error("msg", slog.Any("error", errors.New("user john@example.com already exists")))
+			},
+			fields: map[string]any{"error": "user " + redacted + " already exists"},
+		},
+		{
+			name: "phone in wrapped error",
+			log: func(l *slog.Logger) {
+				l.Error("msg", slog.Any("error", errors.Join(errors.New("sms failed"), errors.New("to +7 912 345 67 89"))))
+			},
+			fields: map[string]any{"error": "sms failed\nto " + redacted},
+		},
+		{
+			name: "error without personal data",
+			log: func(l *slog.Logger) {
+				l.Error("msg", sl.Err(errors.New("connection refused")))
+			},
+			fields: map[string]any{"error": "connection refused"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := logRecord(t, tt.log, keys)
+
+			for path, expected := range tt.fields {
+				if got := field(rec, path); got != expected {
+					t.Errorf("%s: expected %v, got %v", path, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactHandlerFalsePositives(t *testing.T) {
+	values := []string{
+		"1234567890",
+		"123-456-7890",
+		"4f1c2d3e-5a6b-4c7d-8e9f-0a1b2c3d4e5f",
+		"2024-05-01T12:00:00Z",
+		"2024-05-01T12:00:00+03:00",
+		"2024-05-01T12:00:00.123456789-07:00",
+		"Mon, 01 May 2024 12:00:00 +0300",
+		"1714564800",
+		"1714564800123",
+		"v1.2.3",
+		"192.168.0.1:5432",
+		"order 12 345 67",
+	}
+
+	for _, v := range values {
+		t.Run(v, func(t *testing.T) {
+			rec := logRecord(t, func(l *slog.Logger) {
+				l.Info(v, slog.String("value", v), slog.Any("any", v))
+			})
+
+			for _, key := range []string{"msg", "value", "any"} {
+				if got := field(rec, key); got != v {
+					t.Errorf("%s: expected %q to be kept, got %v", key, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactHandlerHash(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	hash := func(key []byte, s string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(s))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+
+	log := func(l *slog.Logger) {
+		l.Info("from john@example.com", slog.String("email", "jane@example.com"))
+	}
+
+	rec := logRecord(t, log, sl.WithRedactKeys("email"), sl.WithRedactMode(sl.RedactHash), sl.WithHashKey(key))
+	if got, expected := field(rec, "msg"), "from "+hash(key, "john@example.com"); got != expected {
+		t.Errorf("msg: expected %v, got %v", expected, got)
+	}
+	if got, expected := field(rec, "email"), hash(key, "jane@example.com"); got != expected {
+		t.Errorf("email: expected %v, got %v", expected, got)
+	}
+
+	// the hashes depend on the key, so they can not be computed without it
+	other := logRecord(t, log, sl.WithRedactKeys("email"), sl.WithRedactMode(sl.RedactHash), sl.WithHashKey([]byte("another key")))
+	if field(other, "email") == field(rec, "email") {
+		t.Error("expected the hashes of different keys to differ")
+	}
+}
+
+func TestRedactHandlerWithoutPatterns(t *testing.T) {
+	rec := logRecord(t, func(l *slog.Logger) {
+		l.Info("from john@example.com", slog.String("email", "jane@example.com"))
+	}, sl.WithRedactKeys("email"), sl.WithoutPatterns())
+
+	if got := field(rec, "msg"); got != "from john@example.com" {
+		t.Errorf("msg: expected the message to be kept, got %v", got)
+	}
+	if got := field(rec, "email"); got != redacted {
+		t.Errorf("email: expected %v, got %v", redacted, got)
+	}
+}
+
+// TestRedactHandlerUserDTO checks that the user DTOs expose the personal data under the configured keys
+func TestRedactHandlerUserDTO(t *testing.T) {
+	dto := usecase.UserDTO{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      "John Doe",
+		Email:     "john@example.com",
+	}
+
+	rec := logRecord(t, func(l *slog.Logger) {
+		l.Info("msg", slog.Any("user", dto), slog.Any("create", usecase.CreateUserDTO{Name: dto.Name, Email: dto.Email}))
+	}, sl.WithRedactKeys("name", "email"), sl.WithoutPatterns())
+
+	for _, path := range []string{"user.name", "user.email", "create.name", "create.email"} {
+		if got := field(rec, path); got != redacted {
+			t.Errorf("%s: expected %v, got %v", path, redacted, got)
+		}
+	}
+
+	if got := field(rec, "user.id"); got != dto.ID.String() {
+		t.Errorf("user.id: expected %v, got %v", dto.ID, got)
+	}
+}
+
+func TestRedactHandlerEnabled(t *testing.T) {
+	h := sl.NewRedactHandler(slog.NewJSONHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	if h.Enabled(context.Background(), slog.LevelInfo) || !h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Fatal("expected the levels of the next handler")
+	}
+}
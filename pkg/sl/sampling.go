@@ -0,0 +1,99 @@
+package sl
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SamplingHandler logs the first records with the same level and message within every tick
+// and then only every thereafter-th of them, the records at or above the max level are never sampled
+type SamplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+type sampler struct {
+	first      int
+	thereafter int
+	tick       time.Duration
+	maxLevel   slog.Level
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[samplingKey]int
+}
+
+type samplingKey struct {
+	level slog.Level
+	msg   string
+}
+
+var _ slog.Handler = (*SamplingHandler)(nil)
+
+// NewSamplingHandler creates a SamplingHandler sampling the records below maxLevel,
+// thereafter of zero drops all the records after the first ones
+func NewSamplingHandler(next slog.Handler, first, thereafter int, tick time.Duration, maxLevel slog.Level) *SamplingHandler {
+	return &SamplingHandler{
+		next: next,
+		sampler: &sampler{
+			first:      first,
+			thereafter: thereafter,
+			tick:       tick,
+			maxLevel:   maxLevel,
+			start:      time.Now(),
+			counts:     make(map[samplingKey]int),
+		},
+	}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.sampler.sample(r) {
+		return nil
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{
+		next:    h.next.WithAttrs(attrs),
+		sampler: h.sampler,
+	}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{
+		next:    h.next.WithGroup(name),
+		sampler: h.sampler,
+	}
+}
+
+func (s *sampler) sample(r slog.Record) bool {
+	if r.Level >= s.maxLevel {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); now.Sub(s.start) >= s.tick {
+		s.start = now
+		clear(s.counts)
+	}
+
+	key := samplingKey{level: r.Level, msg: r.Message}
+	s.counts[key]++
+	n := s.counts[key]
+
+	if n <= s.first {
+		return true
+	}
+
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
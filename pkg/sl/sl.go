@@ -2,8 +2,11 @@ package sl
 
 import "log/slog"
 
+// opKey is the key of the operation attribute
+const opKey = "operation"
+
 func Op(op string) slog.Attr {
-	return slog.String("operation", op)
+	return slog.String(opKey, op)
 }
 
 func Err(err error) slog.Attr {